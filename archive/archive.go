@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -25,6 +24,29 @@ type Archive struct {
 	Metadata map[string]string
 }
 
+// Seek implements io.Seeker so that uploads of the archive can be rewound
+// and retried. An error is returned if the underlying data can't seek.
+func (a *Archive) Seek(offset int64, whence int) (int64, error) {
+	s, ok := a.ReadCloser.(io.Seeker)
+	if !ok {
+		return 0, fmt.Errorf("archive: data is not seekable")
+	}
+
+	return s.Seek(offset, whence)
+}
+
+// ReadAt implements io.ReaderAt so that the archive can be uploaded in
+// chunks. An error is returned if the underlying data can't be read at an
+// offset.
+func (a *Archive) ReadAt(p []byte, off int64) (int, error) {
+	r, ok := a.ReadCloser.(io.ReaderAt)
+	if !ok {
+		return 0, fmt.Errorf("archive: data can't be read at an offset")
+	}
+
+	return r.ReadAt(p, off)
+}
+
 // ArchiveOpts are the options for defining how the archive will be built.
 type ArchiveOpts struct {
 	// Exclude and Include are filters of files to include/exclude in
@@ -43,6 +65,9 @@ type ArchiveOpts struct {
 	// VCS, if true, will detect and use a VCS system to determine what
 	// files to include the archive.
 	VCS bool
+
+	// Logger, if set, receives messages about creating the archive.
+	Logger Logger
 }
 
 // IsSet says whether any options were set.
@@ -63,7 +88,7 @@ const (
 // is needed for almost all operations involving archives with Atlas. Because
 // of this, sufficient disk space will be required to buffer the archive.
 func CreateArchive(path string, opts *ArchiveOpts) (*Archive, error) {
-	log.Printf("[INFO] creating archive from %s", path)
+	opts.logger().Infof("creating archive from %s", path)
 
 	// Dereference any symlinks and determine the real path and info
 	fi, err := os.Lstat(path)
@@ -141,7 +166,7 @@ func archiveDir(root string, opts *ArchiveOpts) (*Archive, error) {
 	if opts.VCS {
 		var err error
 
-		if err = vcsPreflight(root); err != nil {
+		if err = vcsPreflight(root, opts.logger()); err != nil {
 			return nil, err
 		}
 
@@ -505,6 +530,14 @@ func (r *readCloseRemover) Read(p []byte) (int, error) {
 	return r.F.Read(p)
 }
 
+func (r *readCloseRemover) Seek(offset int64, whence int) (int64, error) {
+	return r.F.Seek(offset, whence)
+}
+
+func (r *readCloseRemover) ReadAt(p []byte, off int64) (int, error) {
+	return r.F.ReadAt(p, off)
+}
+
 func (r *readCloseRemover) Close() error {
 	// First close the file
 	err := r.F.Close()
@@ -102,6 +102,55 @@ func TestArchive_fileCompressed(t *testing.T) {
 	}
 }
 
+func TestArchive_seek(t *testing.T) {
+	path := filepath.Join(testFixture("archive-file"), "foo.txt")
+	r, err := CreateArchive(path, new(ArchiveOpts))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer r.Close()
+
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Reading again after rewinding should produce the full archive
+	expected := []string{
+		"foo.txt",
+	}
+
+	entries := testArchive(t, r, false)
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("bad: %#v", entries)
+	}
+}
+
+func TestArchive_readAt(t *testing.T) {
+	path := filepath.Join(testFixture("archive-file"), "foo.txt")
+	r, err := CreateArchive(path, new(ArchiveOpts))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer r.Close()
+
+	expected, err := ioutil.ReadAll(io.NewSectionReader(r, 0, r.Size))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !bytes.Equal(actual, expected) {
+		t.Fatalf("bad: %d bytes read at offsets, %d bytes read", len(expected), len(actual))
+	}
+}
+
 func TestArchive_fileNoExist(t *testing.T) {
 	tf := tempFile(t)
 	if err := os.Remove(tf); err != nil {
@@ -0,0 +1,29 @@
+package archive
+
+// Logger is the interface used by this package to log what it is doing.
+// It has the same method set as the atlas package's Logger, so the same
+// implementation can be used for both. Set ArchiveOpts.Logger to receive
+// the messages; by default nothing is logged.
+type Logger interface {
+	Debugf(format string, v ...interface{})
+	Infof(format string, v ...interface{})
+	Warnf(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+}
+
+// logger returns the Logger to log to for these options.
+func (o *ArchiveOpts) logger() Logger {
+	if o == nil || o.Logger == nil {
+		return nopLogger{}
+	}
+
+	return o.Logger
+}
+
+// nopLogger is the default Logger, which discards everything.
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Infof(string, ...interface{})  {}
+func (nopLogger) Warnf(string, ...interface{})  {}
+func (nopLogger) Errorf(string, ...interface{}) {}
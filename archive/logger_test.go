@@ -0,0 +1,36 @@
+package archive
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testLogger struct {
+	lines []string
+}
+
+func (l *testLogger) Debugf(format string, v ...interface{}) { l.add("DEBUG", format, v) }
+func (l *testLogger) Infof(format string, v ...interface{})  { l.add("INFO", format, v) }
+func (l *testLogger) Warnf(format string, v ...interface{})  { l.add("WARN", format, v) }
+func (l *testLogger) Errorf(format string, v ...interface{}) { l.add("ERR", format, v) }
+
+func (l *testLogger) add(level, format string, v []interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf("[%s] ", level)+fmt.Sprintf(format, v...))
+}
+
+func TestArchiveOpts_logger(t *testing.T) {
+	l := new(testLogger)
+
+	path := filepath.Join(testFixture("archive-file"), "foo.txt")
+	r, err := CreateArchive(path, &ArchiveOpts{Logger: l})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	r.Close()
+
+	if len(l.lines) == 0 || !strings.HasPrefix(l.lines[0], "[INFO] creating archive") {
+		t.Fatalf("bad: %#v", l.lines)
+	}
+}
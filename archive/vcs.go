@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -97,20 +96,34 @@ func vcsDetect(path string) (*VCS, error) {
 	return nil, fmt.Errorf("no VCS found for path: %s", path)
 }
 
-// vcsPreflight returns the metadata for the VCS directory path.
-func vcsPreflight(path string) error {
+// vcsPreflight runs the preflight check of the VCS for the directory path.
+// Warnings from the check are logged to l.
+func vcsPreflight(path string, l Logger) error {
 	vcs, err := vcsDetect(path)
 	if err != nil {
 		return fmt.Errorf("error detecting VCS: %s", err)
 	}
 
 	if vcs.Preflight != nil {
-		return vcs.Preflight(path)
+		err := vcs.Preflight(path)
+		if w, ok := err.(vcsWarning); ok {
+			l.Warnf("%s", w)
+			return nil
+		}
+		return err
 	}
 
 	return nil
 }
 
+// vcsWarning is returned by a preflight check for a problem that doesn't
+// stop the VCS from being used. vcsPreflight logs it and carries on.
+type vcsWarning string
+
+func (w vcsWarning) Error() string {
+	return string(w)
+}
+
 // vcsFiles returns the files for the VCS directory path.
 func vcsFiles(path string) ([]string, error) {
 	vcs, err := vcsDetect(path)
@@ -308,21 +321,18 @@ func gitPreflight(path string) error {
 	// Check if the output is valid
 	output := strings.Split(strings.TrimSpace(stdout.String()), " ")
 	if len(output) < 1 {
-		log.Printf("[WARN] could not extract version output from Git")
-		return nil
+		return vcsWarning("could not extract version output from Git")
 	}
 
 	// Parse the version
 	gitv, err := version.NewVersion(output[len(output)-1])
 	if err != nil {
-		log.Printf("[WARN] could not parse version output from Git")
-		return nil
+		return vcsWarning("could not parse version output from Git")
 	}
 
 	constraint, err := version.NewConstraint("> 1.8")
 	if err != nil {
-		log.Printf("[WARN] could not create version constraint to check")
-		return nil
+		return vcsWarning("could not create version constraint to check")
 	}
 	if !constraint.Check(gitv) {
 		return fmt.Errorf("git version (%s) is too old, please upgrade", gitv.String())
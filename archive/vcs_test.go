@@ -42,7 +42,7 @@ func TestVCSPreflight(t *testing.T) {
 	testDir, cleanup := setupGitFixtures(t)
 	defer cleanup()
 
-	if err := vcsPreflight(testDir); err != nil {
+	if err := vcsPreflight(testDir, nopLogger{}); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -0,0 +1,120 @@
+package atlas
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AMIArtifactType is the artifact type of Amazon machine images.
+const AMIArtifactType = "amazon.ami"
+
+// AMIs maps AWS regions to the IDs of the AMIs in them. The ID of an
+// amazon.ami ArtifactVersion is a comma-separated list of "region:ami-id"
+// pairs, which ParseAMIs parses and String builds:
+//
+//	opts.ID = AMIs{"us-east-1": "ami-1234", "us-west-2": "ami-5678"}.String()
+type AMIs map[string]string
+
+// ParseAMIs parses the ID of an amazon.ami artifact version, such as
+// "us-east-1:ami-1234,us-west-2:ami-5678".
+func ParseAMIs(id string) (AMIs, error) {
+	amis := make(AMIs)
+	for _, pair := range strings.Split(id, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("client: invalid AMI %q, expected region:ami-id", pair)
+		}
+
+		region, ami := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if _, ok := amis[region]; ok {
+			return nil, fmt.Errorf("client: duplicate AMI for region %s", region)
+		}
+		amis[region] = ami
+	}
+
+	return amis, nil
+}
+
+// String returns the AMIs in the form of an amazon.ami artifact ID, with
+// the regions sorted.
+func (a AMIs) String() string {
+	regions := a.Regions()
+	pairs := make([]string, len(regions))
+	for i, region := range regions {
+		pairs[i] = region + ":" + a[region]
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// Regions returns the regions that have an AMI, sorted.
+func (a AMIs) Regions() []string {
+	regions := make([]string, 0, len(a))
+	for region := range a {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+
+	return regions
+}
+
+// AMIs parses the ID of an amazon.ami artifact version. See ParseAMIs.
+func (av *ArtifactVersion) AMIs() (AMIs, error) {
+	return ParseAMIs(av.ID)
+}
+
+// ResolveAMI finds the latest amazon.ami artifact version matching the
+// search options and returns its AMI for the given region, along with the
+// version. If opts.Type is empty, AMIArtifactType is used.
+//
+// If no version matches, an *ArtifactVersionNotFoundError is returned. If
+// the latest version has no AMI for the region, the error returned matches
+// ErrNotFound (see errors.Is).
+func (c *Client) ResolveAMI(opts *ArtifactSearchOpts, region string) (string, *ArtifactVersion, error) {
+	return c.ResolveAMIContext(context.Background(), opts, region)
+}
+
+// ResolveAMIContext is like ResolveAMI, but uses the given context for the
+// requests.
+func (c *Client) ResolveAMIContext(ctx context.Context, opts *ArtifactSearchOpts, region string) (string, *ArtifactVersion, error) {
+	search := *opts
+	if search.Type == "" {
+		search.Type = AMIArtifactType
+	}
+
+	var latest *ArtifactVersion
+	err := c.ArtifactSearchIterContext(ctx, &search).ForEach(func(av *ArtifactVersion) error {
+		if latest == nil || av.Version > latest.Version {
+			latest = av
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	if latest == nil {
+		return "", nil, &ArtifactVersionNotFoundError{
+			User: search.User, Name: search.Name, Type: search.Type, Err: ErrNotFound}
+	}
+
+	amis, err := latest.AMIs()
+	if err != nil {
+		return "", nil, err
+	}
+
+	ami, ok := amis[region]
+	if !ok {
+		return "", latest, fmt.Errorf("client: artifact %s/%s version %d has no AMI in %s: %w",
+			search.User, search.Name, latest.Version, region, ErrNotFound)
+	}
+
+	return ami, latest, nil
+}
@@ -0,0 +1,98 @@
+package atlas
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseAMIs(t *testing.T) {
+	amis, err := ParseAMIs("us-west-2:ami-5678, us-east-1:ami-1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := AMIs{"us-east-1": "ami-1234", "us-west-2": "ami-5678"}
+	if !reflect.DeepEqual(amis, expected) {
+		t.Fatalf("bad: %#v", amis)
+	}
+
+	if id := amis.String(); id != "us-east-1:ami-1234,us-west-2:ami-5678" {
+		t.Fatalf("expected %q to be %q", id, "us-east-1:ami-1234,us-west-2:ami-5678")
+	}
+}
+
+func TestParseAMIs_invalid(t *testing.T) {
+	cases := []string{
+		"ami-1234",
+		"us-east-1:",
+		":ami-1234",
+		"us-east-1:ami-1234,us-east-1:ami-5678",
+	}
+
+	for _, id := range cases {
+		if _, err := ParseAMIs(id); err == nil {
+			t.Fatalf("%q: expected error, but nothing was returned", id)
+		}
+	}
+}
+
+func TestResolveAMI(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ami, av, err := client.ResolveAMI(&ArtifactSearchOpts{
+		User:     "hashicorp",
+		Name:     "amis",
+		Metadata: map[string]string{"channel": "stable"},
+	}, "us-west-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ami != "ami-5656" {
+		t.Fatalf("expected %q to be %q", ami, "ami-5656")
+	}
+	if av.Version != 5 {
+		t.Fatalf("expected %d to be %d", av.Version, 5)
+	}
+}
+
+func TestResolveAMI_notFound(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No AMI in the region
+	_, _, err = client.ResolveAMI(&ArtifactSearchOpts{
+		User: "hashicorp",
+		Name: "amis",
+	}, "eu-west-1")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v to be ErrNotFound", err)
+	}
+
+	// No matching versions
+	_, _, err = client.ResolveAMI(&ArtifactSearchOpts{
+		User:     "hashicorp",
+		Name:     "amis",
+		Metadata: map[string]string{"other": "value"},
+	}, "us-east-1")
+
+	var notFound *ArtifactVersionNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected *ArtifactVersionNotFoundError, got %#v", err)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v to be ErrNotFound", err)
+	}
+}
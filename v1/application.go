@@ -2,10 +2,12 @@ package atlas
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"net/http"
+	"time"
 )
 
 // appWrapper is the API wrapper since the server wraps the resulting object.
@@ -31,15 +33,20 @@ func (a *App) Slug() string {
 // App gets the App by the given user space and name. In the event the App is
 // not found (404), or for any other non-200 responses, an error is returned.
 func (c *Client) App(user, name string) (*App, error) {
-	log.Printf("[INFO] getting application %s/%s", user, name)
+	return c.AppContext(context.Background(), user, name)
+}
+
+// AppContext is like App, but uses the given context for the request.
+func (c *Client) AppContext(ctx context.Context, user, name string) (*App, error) {
+	c.logger().Infof("getting application %s/%s", user, name)
 
 	endpoint := fmt.Sprintf("/api/v1/vagrant/applications/%s/%s", user, name)
-	request, err := c.Request("GET", endpoint, nil)
+	request, err := c.RequestContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	response, err := checkResp(c.HTTPClient.Do(request))
+	response, err := c.do(request)
 	if err != nil {
 		return nil, err
 	}
@@ -56,7 +63,13 @@ func (c *Client) App(user, name string) (*App, error) {
 // App is created successfully, it is returned. If the server returns any
 // errors, an error is returned.
 func (c *Client) CreateApp(user, name string) (*App, error) {
-	log.Printf("[INFO] creating application %s/%s", user, name)
+	return c.CreateAppContext(context.Background(), user, name)
+}
+
+// CreateAppContext is like CreateApp, but uses the given context for the
+// request.
+func (c *Client) CreateAppContext(ctx context.Context, user, name string) (*App, error) {
+	c.logger().Infof("creating application %s/%s", user, name)
 
 	body, err := json.Marshal(&appWrapper{&App{
 		User: user,
@@ -67,7 +80,7 @@ func (c *Client) CreateApp(user, name string) (*App, error) {
 	}
 
 	endpoint := "/api/v1/vagrant/applications"
-	request, err := c.Request("POST", endpoint, &RequestOptions{
+	request, err := c.RequestContext(ctx, "POST", endpoint, &RequestOptions{
 		Body: bytes.NewReader(body),
 		Headers: map[string]string{
 			"Content-Type": "application/json",
@@ -77,7 +90,7 @@ func (c *Client) CreateApp(user, name string) (*App, error) {
 		return nil, err
 	}
 
-	response, err := checkResp(c.HTTPClient.Do(request))
+	response, err := c.do(request)
 	if err != nil {
 		return nil, err
 	}
@@ -90,12 +103,32 @@ func (c *Client) CreateApp(user, name string) (*App, error) {
 	return &app, nil
 }
 
-// appVersion represents a specific version of an App in Atlas. It is actually
-// an upload container/wrapper.
-type appVersion struct {
-	UploadPath string `json:"upload_path"`
-	Token      string `json:"token"`
-	Version    uint64 `json:"version"`
+// AppVersion represents a specific version of an App in Atlas.
+type AppVersion struct {
+	// Version is the version number.
+	Version uint64 `json:"version"`
+
+	// Metadata is the metadata the version was uploaded with.
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+
+	// CreatedAt is when the version was created, if the server says.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+
+	// UploadPath and Token are where the data of a new version is to be
+	// uploaded, and the token that authorizes it. They are only set on the
+	// version returned by UploadAppVersion.
+	UploadPath string `json:"upload_path,omitempty"`
+	Token      string `json:"token,omitempty"`
+}
+
+// appVersionWrapper is the API wrapper around a single AppVersion.
+type appVersionWrapper struct {
+	Version *AppVersion `json:"version"`
+}
+
+// appVersionsWrapper is the API wrapper around a list of AppVersions.
+type appVersionsWrapper struct {
+	Versions []*AppVersion `json:"versions"`
 }
 
 // appMetadataWrapper is a wrapper around a map the prefixes the json key with
@@ -110,10 +143,39 @@ type appMetadataWrapper struct {
 //
 // It is the responsibility of the caller to create a properly-formed data
 // object; this method blindly passes along the contents of the io.Reader.
+// Large data can be uploaded in resumable chunks, for every upload or just
+// this one with UploadAppContext; see UploadOptions.
 func (c *Client) UploadApp(app *App, metadata map[string]interface{},
 	data io.Reader, size int64) (uint64, error) {
+	return c.UploadAppContext(context.Background(), app, metadata, data, size, nil)
+}
+
+// UploadAppContext is like UploadApp, but uses the given context for the
+// requests, including the file upload. The upload options, if not nil, are
+// used for the file upload instead of the client's UploadOptions.
+func (c *Client) UploadAppContext(ctx context.Context, app *App, metadata map[string]interface{},
+	data io.Reader, size int64, opts *UploadOptions) (uint64, error) {
+	av, err := c.UploadAppVersionContext(ctx, app, metadata, data, size, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	return av.Version, nil
+}
+
+// UploadAppVersion is like UploadApp, but returns the whole AppVersion that
+// was created.
+func (c *Client) UploadAppVersion(app *App, metadata map[string]interface{},
+	data io.Reader, size int64) (*AppVersion, error) {
+	return c.UploadAppVersionContext(context.Background(), app, metadata, data, size, nil)
+}
 
-	log.Printf("[INFO] uploading application %s (%d bytes) with metadata %q",
+// UploadAppVersionContext is like UploadAppVersion, but uses the given
+// context and upload options like UploadAppContext.
+func (c *Client) UploadAppVersionContext(ctx context.Context, app *App, metadata map[string]interface{},
+	data io.Reader, size int64, opts *UploadOptions) (*AppVersion, error) {
+
+	c.logger().Infof("uploading application %s (%d bytes) with metadata %q",
 		app.Slug(), size, metadata)
 
 	endpoint := fmt.Sprintf("/api/v1/vagrant/applications/%s/%s/versions",
@@ -131,7 +193,7 @@ func (c *Client) UploadApp(app *App, metadata map[string]interface{},
 		}
 		m, err := json.Marshal(wrapper)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
 
 		// Create the request options.
@@ -141,24 +203,158 @@ func (c *Client) UploadApp(app *App, metadata map[string]interface{},
 		}
 	}
 
-	request, err := c.Request("POST", endpoint, ro)
+	request, err := c.RequestContext(ctx, "POST", endpoint, ro)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	response, err := checkResp(c.HTTPClient.Do(request))
+	response, err := c.do(request)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	var av appVersion
+	var av AppVersion
 	if err := decodeJSON(response, &av); err != nil {
-		return 0, err
+		return nil, err
 	}
+	c.addSecret(av.Token)
 
-	if err := c.putFile(av.UploadPath, data, size); err != nil {
-		return 0, err
+	if err := c.putFile(ctx, av.UploadPath, data, size, opts); err != nil {
+		return nil, err
 	}
 
-	return av.Version, nil
+	return &av, nil
+}
+
+// AppVersions returns every version of the App, with its metadata. Use
+// AppVersionsIter to fetch the pages of versions as they are needed.
+func (c *Client) AppVersions(app *App) ([]*AppVersion, error) {
+	return c.AppVersionsContext(context.Background(), app)
+}
+
+// AppVersionsContext is like AppVersions, but uses the given context for
+// the requests.
+func (c *Client) AppVersionsContext(ctx context.Context, app *App) ([]*AppVersion, error) {
+	versions, err := c.AppVersionsIterContext(ctx, app, nil).All()
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// AppVersionsIter returns an iterator over the versions of the App. A nil
+// opts is the same as an empty one.
+func (c *Client) AppVersionsIter(app *App, opts *ListOptions) *AppVersionIterator {
+	return c.AppVersionsIterContext(context.Background(), app, opts)
+}
+
+// AppVersionsIterContext is like AppVersionsIter, but uses the given context
+// for the requests.
+func (c *Client) AppVersionsIterContext(ctx context.Context, app *App, opts *ListOptions) *AppVersionIterator {
+	c.logger().Infof("listing versions of application %s", app.Slug())
+
+	if opts == nil {
+		opts = new(ListOptions)
+	}
+
+	endpoint := fmt.Sprintf("/api/v1/vagrant/applications/%s/%s/versions",
+		app.User, app.Name)
+
+	it := &AppVersionIterator{new(iterator)}
+	it.pager = newPager(ctx, c, endpoint, nil, *opts,
+		func(response *http.Response) ([]interface{}, error) {
+			var w appVersionsWrapper
+			if err := decodeJSON(response, &w); err != nil {
+				return nil, err
+			}
+
+			items := make([]interface{}, len(w.Versions))
+			for i, v := range w.Versions {
+				items[i] = v
+			}
+			return items, nil
+		})
+
+	return it
+}
+
+// AppVersion gets the given version of the App. If the version doesn't
+// exist, an error matching ErrNotFound (see errors.Is) is returned.
+func (c *Client) AppVersion(app *App, version uint64) (*AppVersion, error) {
+	return c.AppVersionContext(context.Background(), app, version)
+}
+
+// AppVersionContext is like AppVersion, but uses the given context for the
+// request.
+func (c *Client) AppVersionContext(ctx context.Context, app *App, version uint64) (*AppVersion, error) {
+	c.logger().Infof("getting application %s version %d", app.Slug(), version)
+
+	endpoint := fmt.Sprintf("/api/v1/vagrant/applications/%s/%s/versions/%d",
+		app.User, app.Name, version)
+	request, err := c.RequestContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var w appVersionWrapper
+	if err := decodeJSON(response, &w); err != nil {
+		return nil, err
+	}
+	if w.Version == nil {
+		return nil, fmt.Errorf("client: missing version in response")
+	}
+
+	return w.Version, nil
+}
+
+// DownloadAppVersion downloads the slug (the uploaded data) of the given
+// version of the App into w, returning the number of bytes written. Like
+// DownloadArtifact, the token isn't sent to the storage backend, and
+// interrupted downloads are resumed.
+func (c *Client) DownloadAppVersion(app *App, version uint64, w io.WriterAt, opts *DownloadArtifactOpts) (int64, error) {
+	return c.DownloadAppVersionContext(context.Background(), app, version, w, opts)
+}
+
+// DownloadAppVersionContext is like DownloadAppVersion, but uses the given
+// context for the requests.
+func (c *Client) DownloadAppVersionContext(ctx context.Context, app *App, version uint64,
+	w io.WriterAt, opts *DownloadArtifactOpts) (int64, error) {
+	c.logger().Infof("downloading application %s version %d", app.Slug(), version)
+
+	endpoint := fmt.Sprintf("/api/v1/vagrant/applications/%s/%s/versions/%d/slug",
+		app.User, app.Name, version)
+	return c.fetchFile(ctx, endpoint, w, 0, nil, opts)
+}
+
+// DeleteAppVersion deletes the given version of the App. If the version
+// doesn't exist, an error matching ErrNotFound (see errors.Is) is returned.
+func (c *Client) DeleteAppVersion(app *App, version uint64) error {
+	return c.DeleteAppVersionContext(context.Background(), app, version)
+}
+
+// DeleteAppVersionContext is like DeleteAppVersion, but uses the given
+// context for the request.
+func (c *Client) DeleteAppVersionContext(ctx context.Context, app *App, version uint64) error {
+	c.logger().Infof("deleting application %s version %d", app.Slug(), version)
+
+	endpoint := fmt.Sprintf("/api/v1/vagrant/applications/%s/%s/versions/%d",
+		app.User, app.Name, version)
+	request, err := c.RequestContext(ctx, "DELETE", endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return err
+	}
+	discardResp(response)
+
+	return nil
 }
@@ -2,6 +2,8 @@ package atlas
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"testing"
 )
 
@@ -116,3 +118,163 @@ func TestUploadApp_createsAndReturnsVersion(t *testing.T) {
 		t.Fatalf("bad: %#v", version)
 	}
 }
+
+func TestUploadAppVersion(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &App{User: "hashicorp", Name: "existing"}
+	metadata := map[string]interface{}{"testing": true}
+	av, err := client.UploadAppVersion(app, metadata, new(bytes.Buffer), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if av.Version != 125 {
+		t.Fatalf("expected %d to be %d", av.Version, 125)
+	}
+	if av.Token != "630e42d9-2364-2412-4121-18266770468e" {
+		t.Fatalf("bad: %#v", av)
+	}
+}
+
+func TestUploadAppContext_uploadOptions(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress := new(testProgress)
+	app := &App{User: "hashicorp", Name: "existing"}
+	metadata := map[string]interface{}{"testing": true}
+	data := bytes.NewReader([]byte("hello"))
+	_, err = client.UploadAppContext(context.Background(), app, metadata, data, data.Size(),
+		&UploadOptions{Progress: progress.report})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := progress.last()
+	if last.Bytes != 5 || last.Total != 5 {
+		t.Fatalf("bad: %#v", last)
+	}
+}
+
+func TestUploadAppContext_chunked(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &App{User: "hashicorp", Name: "chunked"}
+	data := bytes.NewReader([]byte("hello, chunked world"))
+	_, err = client.UploadAppContext(context.Background(), app, nil, data, data.Size(),
+		&UploadOptions{ChunkSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploads := server.uploadedBodies()
+	if len(uploads) != 1 || uploads[0] != "hello, chunked world" {
+		t.Fatalf("bad: %#v", uploads)
+	}
+	if n := server.attemptCount("/_binstore-chunked/ok@16"); n != 1 {
+		t.Fatalf("expected the last chunk to be sent once, got %d", n)
+	}
+}
+
+func TestAppVersions(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := client.AppVersions(&App{User: "hashicorp", Name: "existing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(versions) != 2 {
+		t.Fatalf("bad: %#v", versions)
+	}
+	if versions[0].Version != 1 || versions[0].Metadata["testing"] != true {
+		t.Fatalf("bad: %#v", versions[0])
+	}
+}
+
+func TestAppVersion(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &App{User: "hashicorp", Name: "existing"}
+	av, err := client.AppVersion(app, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if av.Version != 2 {
+		t.Fatalf("expected %d to be %d", av.Version, 2)
+	}
+
+	_, err = client.AppVersion(app, 3)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v to be ErrNotFound", err)
+	}
+}
+
+func TestDownloadAppVersion(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := new(memWriterAt)
+	n, err := client.DownloadAppVersion(&App{User: "hashicorp", Name: "existing"}, 1, w, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != int64(len(testArtifactFile)) || !bytes.Equal(w.buf, testArtifactFile) {
+		t.Fatalf("bad: %d bytes", n)
+	}
+}
+
+func TestDeleteAppVersion(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &App{User: "hashicorp", Name: "existing"}
+	if err := client.DeleteAppVersion(app, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.DeleteAppVersion(app, 3); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v to be ErrNotFound", err)
+	}
+}
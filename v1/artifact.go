@@ -2,11 +2,16 @@ package atlas
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"net/http"
 	"net/url"
+	"strings"
 )
 
 // Artifact represents a single instance of an artifact.
@@ -43,6 +48,13 @@ type ArtifactSearchOpts struct {
 	Build    string
 	Version  string
 	Metadata map[string]string
+
+	// Query adds more filters to the search. They are combined with the
+	// fields above, but Query's Build and Version take precedence.
+	Query *ArtifactQuery
+
+	// ListOptions sets the page size, and the page to start from.
+	ListOptions
 }
 
 // UploadArtifactOpts are the options used to upload an artifact.
@@ -56,6 +68,10 @@ type UploadArtifactOpts struct {
 	Metadata  map[string]string
 	BuildID   int
 	CompileID int
+
+	// Upload, if set, is used to upload File instead of the client's
+	// UploadOptions.
+	Upload *UploadOptions
 }
 
 // MarshalJSON converts the UploadArtifactOpts into a JSON struct.
@@ -76,16 +92,22 @@ func (o *UploadArtifactOpts) MarshalJSON() ([]byte, error) {
 const MetadataAnyValue = "943febbf-589f-401b-8f25-58f6d8786848"
 
 // Artifact finds the Atlas artifact by the given name and returns it. Any
-// errors that occur are returned, including ErrAuth and ErrNotFound special
-// exceptions which the user may want to handle separately.
+// errors that occur are returned, including errors matching ErrAuth and
+// ErrNotFound (see errors.Is) which the user may want to handle separately.
 func (c *Client) Artifact(user, name string) (*Artifact, error) {
+	return c.ArtifactContext(context.Background(), user, name)
+}
+
+// ArtifactContext is like Artifact, but uses the given context for the
+// request.
+func (c *Client) ArtifactContext(ctx context.Context, user, name string) (*Artifact, error) {
 	endpoint := fmt.Sprintf("/api/v1/artifacts/%s/%s", user, name)
-	request, err := c.Request("GET", endpoint, nil)
+	request, err := c.RequestContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	response, err := checkResp(c.HTTPClient.Do(request))
+	response, err := c.do(request)
 	if err != nil {
 		return nil, err
 	}
@@ -99,55 +121,224 @@ func (c *Client) Artifact(user, name string) (*Artifact, error) {
 }
 
 // ArtifactSearch searches Atlas for the given ArtifactSearchOpts and returns
-// a slice of ArtifactVersions.
+// a slice of ArtifactVersions. Every page of results is fetched; use
+// ArtifactSearchIter to fetch them as they are needed.
 func (c *Client) ArtifactSearch(opts *ArtifactSearchOpts) ([]*ArtifactVersion, error) {
-	log.Printf("[INFO] searching artifacts: %#v", opts)
+	return c.ArtifactSearchContext(context.Background(), opts)
+}
 
-	params := make(map[string]string)
-	if opts.Version != "" {
-		params["version"] = opts.Version
-	}
-	if opts.Build != "" {
-		params["build"] = opts.Build
+// ArtifactSearchContext is like ArtifactSearch, but uses the given context
+// for the requests.
+func (c *Client) ArtifactSearchContext(ctx context.Context, opts *ArtifactSearchOpts) ([]*ArtifactVersion, error) {
+	versions, err := c.ArtifactSearchIterContext(ctx, opts).All()
+	if err != nil {
+		return nil, err
 	}
 
-	i := 1
-	for k, v := range opts.Metadata {
-		prefix := fmt.Sprintf("metadata.%d.", i)
-		params[prefix+"key"] = k
-		if v != MetadataAnyValue {
-			params[prefix+"value"] = v
-		}
+	return versions, nil
+}
 
-		i++
-	}
+// ArtifactSearchIter searches Atlas for the given ArtifactSearchOpts and
+// returns an iterator over the resulting ArtifactVersions. Pages of results
+// are only fetched as the iterator reaches them.
+func (c *Client) ArtifactSearchIter(opts *ArtifactSearchOpts) *ArtifactVersionIterator {
+	return c.ArtifactSearchIterContext(context.Background(), opts)
+}
+
+// ArtifactSearchIterContext is like ArtifactSearchIter, but uses the given
+// context for the requests.
+func (c *Client) ArtifactSearchIterContext(ctx context.Context, opts *ArtifactSearchOpts) *ArtifactVersionIterator {
+	query := opts.query()
+	c.logger().Infof("searching artifacts: %s/%s (%s): %s",
+		opts.User, opts.Name, opts.Type, query)
+
+	params := query.params()
 
 	endpoint := fmt.Sprintf("/api/v1/artifacts/%s/%s/%s/search",
 		opts.User, opts.Name, opts.Type)
-	request, err := c.Request("GET", endpoint, &RequestOptions{
-		Params: params,
-	})
+
+	it := &ArtifactVersionIterator{new(iterator)}
+	it.pager = newPager(ctx, c, endpoint, params, opts.ListOptions,
+		func(response *http.Response) ([]interface{}, error) {
+			var w artifactSearchWrapper
+			if err := decodeJSON(response, &w); err != nil {
+				return nil, err
+			}
+
+			items := make([]interface{}, len(w.Versions))
+			for i, v := range w.Versions {
+				items[i] = v
+			}
+			return items, nil
+		})
+	it.pager.cache = c.Cache
+
+	return it
+}
+
+// ArtifactVersionNotFoundError is returned when an artifact version doesn't
+// exist. It wraps the *APIError of the response, so errors.Is(err,
+// ErrNotFound) also reports true.
+type ArtifactVersionNotFoundError struct {
+	User string
+	Name string
+	Type string
+
+	// Version is the version that was requested, or zero for the latest.
+	Version int
+
+	Err error
+}
+
+func (e *ArtifactVersionNotFoundError) Error() string {
+	if e.Version == 0 {
+		return fmt.Sprintf("client: artifact %s/%s (%s) has no versions",
+			e.User, e.Name, e.Type)
+	}
+
+	return fmt.Sprintf("client: artifact %s/%s (%s) version %d not found",
+		e.User, e.Name, e.Type, e.Version)
+}
+
+// Unwrap returns the *APIError of the response.
+func (e *ArtifactVersionNotFoundError) Unwrap() error {
+	return e.Err
+}
+
+// ArtifactVersionInUseError is returned when an artifact version can't be
+// deleted because it is still in use, for example by a build. It wraps the
+// *APIError of the response, so errors.Is(err, ErrConflict) also reports
+// true, and the server's reasons can be read with errors.As.
+type ArtifactVersionInUseError struct {
+	User    string
+	Name    string
+	Type    string
+	Version int
+
+	Err error
+}
+
+func (e *ArtifactVersionInUseError) Error() string {
+	return fmt.Sprintf("client: artifact %s/%s (%s) version %d is in use: %s",
+		e.User, e.Name, e.Type, e.Version, e.Err)
+}
+
+// Unwrap returns the *APIError of the response.
+func (e *ArtifactVersionInUseError) Unwrap() error {
+	return e.Err
+}
+
+// ArtifactVersion gets the given version of the artifact. If the version
+// doesn't exist, an *ArtifactVersionNotFoundError is returned.
+func (c *Client) ArtifactVersion(user, name, typ string, version int) (*ArtifactVersion, error) {
+	return c.ArtifactVersionContext(context.Background(), user, name, typ, version)
+}
+
+// ArtifactVersionContext is like ArtifactVersion, but uses the given
+// context for the request.
+func (c *Client) ArtifactVersionContext(ctx context.Context, user, name, typ string, version int) (*ArtifactVersion, error) {
+	c.logger().Infof("getting artifact version: %s/%s (%s) version %d",
+		user, name, typ, version)
+
+	endpoint := fmt.Sprintf("/api/v1/artifacts/%s/%s/%s/%d", user, name, typ, version)
+	av, err := c.artifactVersion(ctx, endpoint)
+	if errors.Is(err, ErrNotFound) {
+		return nil, &ArtifactVersionNotFoundError{
+			User: user, Name: name, Type: typ, Version: version, Err: err}
+	}
+
+	return av, err
+}
+
+// LatestArtifactVersion gets the latest version of the artifact. If the
+// artifact has no versions, an *ArtifactVersionNotFoundError is returned.
+func (c *Client) LatestArtifactVersion(user, name, typ string) (*ArtifactVersion, error) {
+	return c.LatestArtifactVersionContext(context.Background(), user, name, typ)
+}
+
+// LatestArtifactVersionContext is like LatestArtifactVersion, but uses the
+// given context for the request.
+func (c *Client) LatestArtifactVersionContext(ctx context.Context, user, name, typ string) (*ArtifactVersion, error) {
+	c.logger().Infof("getting latest artifact version: %s/%s (%s)", user, name, typ)
+
+	endpoint := fmt.Sprintf("/api/v1/artifacts/%s/%s/%s/latest", user, name, typ)
+	av, err := c.artifactVersion(ctx, endpoint)
+	if errors.Is(err, ErrNotFound) {
+		return nil, &ArtifactVersionNotFoundError{
+			User: user, Name: name, Type: typ, Err: err}
+	}
+
+	return av, err
+}
+
+// artifactVersion gets the artifact version at the given endpoint.
+func (c *Client) artifactVersion(ctx context.Context, endpoint string) (*ArtifactVersion, error) {
+	request, err := c.RequestContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	response, err := checkResp(c.HTTPClient.Do(request))
+	response, err := c.do(request)
 	if err != nil {
 		return nil, err
 	}
 
-	var w artifactSearchWrapper
+	var w artifactVersionWrapper
 	if err := decodeJSON(response, &w); err != nil {
 		return nil, err
 	}
+	if w.Version == nil {
+		return nil, fmt.Errorf("client: missing version in response")
+	}
+
+	return w.Version, nil
+}
+
+// DeleteArtifactVersion deletes the given version of the artifact. If the
+// version doesn't exist, an *ArtifactVersionNotFoundError is returned, and
+// if it is still in use, an *ArtifactVersionInUseError.
+func (c *Client) DeleteArtifactVersion(user, name, typ string, version int) error {
+	return c.DeleteArtifactVersionContext(context.Background(), user, name, typ, version)
+}
+
+// DeleteArtifactVersionContext is like DeleteArtifactVersion, but uses the
+// given context for the request.
+func (c *Client) DeleteArtifactVersionContext(ctx context.Context, user, name, typ string, version int) error {
+	c.logger().Infof("deleting artifact version: %s/%s (%s) version %d",
+		user, name, typ, version)
+
+	endpoint := fmt.Sprintf("/api/v1/artifacts/%s/%s/%s/%d", user, name, typ, version)
+	request, err := c.RequestContext(ctx, "DELETE", endpoint, nil)
+	if err != nil {
+		return err
+	}
 
-	return w.Versions, nil
+	response, err := c.do(request)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return &ArtifactVersionNotFoundError{
+			User: user, Name: name, Type: typ, Version: version, Err: err}
+	case errors.Is(err, ErrConflict):
+		return &ArtifactVersionInUseError{
+			User: user, Name: name, Type: typ, Version: version, Err: err}
+	case err != nil:
+		return err
+	}
+	discardResp(response)
+
+	return nil
 }
 
 // CreateArtifact creates and returns a new Artifact in Atlas. Any errors that
 // occurr are returned.
 func (c *Client) CreateArtifact(user, name string) (*Artifact, error) {
-	log.Printf("[INFO] creating artifact: %s/%s", user, name)
+	return c.CreateArtifactContext(context.Background(), user, name)
+}
+
+// CreateArtifactContext is like CreateArtifact, but uses the given context
+// for the request.
+func (c *Client) CreateArtifactContext(ctx context.Context, user, name string) (*Artifact, error) {
+	c.logger().Infof("creating artifact: %s/%s", user, name)
 	body, err := json.Marshal(&artifactWrapper{&Artifact{
 		User: user,
 		Name: name,
@@ -157,7 +348,7 @@ func (c *Client) CreateArtifact(user, name string) (*Artifact, error) {
 	}
 
 	endpoint := "/api/v1/artifacts"
-	request, err := c.Request("POST", endpoint, &RequestOptions{
+	request, err := c.RequestContext(ctx, "POST", endpoint, &RequestOptions{
 		Body: bytes.NewReader(body),
 		Headers: map[string]string{
 			"Content-Type": "application/json",
@@ -167,7 +358,7 @@ func (c *Client) CreateArtifact(user, name string) (*Artifact, error) {
 		return nil, err
 	}
 
-	response, err := checkResp(c.HTTPClient.Do(request))
+	response, err := c.do(request)
 	if err != nil {
 		return nil, err
 	}
@@ -194,19 +385,59 @@ func (c *Client) ArtifactFileURL(av *ArtifactVersion) (*url.URL, error) {
 }
 
 // UploadArtifact streams the upload of a file on disk using the given
-// UploadArtifactOpts. Any errors that occur are returned.
+// UploadArtifactOpts. Any errors that occur are returned. Large files can be
+// uploaded in resumable chunks; see UploadOptions.
+//
+// The file is hashed as it's uploaded. If the metadata has a SHA-256
+// checksum (see MetadataChecksumKey), a *ChecksumError is returned if it
+// doesn't match the data sent. A *ChecksumError is also returned if the
+// storage reports a different checksum (see StorageChecksumHeader).
+//
+// If the metadata has no checksum, one is added so that downloads can be
+// verified. For a file that implements io.Seeker, the file is hashed before
+// the version is created, and the checksum is sent with the rest of the
+// metadata. Other files can only be hashed as they're uploaded, so their
+// checksum is added to the version afterwards; if that fails, the new
+// version is returned along with a *ChecksumRecordError.
 func (c *Client) UploadArtifact(opts *UploadArtifactOpts) (*ArtifactVersion, error) {
-	log.Printf("[INFO] uploading artifact: %s/%s (%s)", opts.User, opts.Name, opts.Type)
+	return c.UploadArtifactContext(context.Background(), opts)
+}
+
+// UploadArtifactContext is like UploadArtifact, but uses the given context
+// for the requests, including the file upload.
+func (c *Client) UploadArtifactContext(ctx context.Context, opts *UploadArtifactOpts) (*ArtifactVersion, error) {
+	c.logger().Infof("uploading artifact: %s/%s (%s)", opts.User, opts.Name, opts.Type)
 
 	endpoint := fmt.Sprintf("/api/v1/artifacts/%s/%s/%s",
 		opts.User, opts.Name, opts.Type)
 
-	body, err := json.Marshal(opts)
+	sum, hasSum := metadataChecksum(opts.Metadata)
+
+	// Send the checksum with the new version if the file can be hashed
+	// before it's uploaded
+	create := opts
+	if seeker, ok := opts.File.(io.Seeker); ok && !hasSum {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		digest, err := hashSection(ctx, sha256.New(), opts.File, seeker, offset, opts.FileSize)
+		if err != nil {
+			return nil, err
+		}
+		sum, hasSum = hex.EncodeToString(digest), true
+
+		withSum := *opts
+		withSum.Metadata = checksumMetadata(opts.Metadata, sum)
+		create = &withSum
+	}
+
+	body, err := json.Marshal(create)
 	if err != nil {
 		return nil, err
 	}
 
-	request, err := c.Request("POST", endpoint, &RequestOptions{
+	request, err := c.RequestContext(ctx, "POST", endpoint, &RequestOptions{
 		Body: bytes.NewReader(body),
 		Headers: map[string]string{
 			"Content-Type": "application/json",
@@ -216,7 +447,7 @@ func (c *Client) UploadArtifact(opts *UploadArtifactOpts) (*ArtifactVersion, err
 		return nil, err
 	}
 
-	response, err := checkResp(c.HTTPClient.Do(request))
+	response, err := c.do(request)
 	if err != nil {
 		return nil, err
 	}
@@ -225,16 +456,108 @@ func (c *Client) UploadArtifact(opts *UploadArtifactOpts) (*ArtifactVersion, err
 	if err := decodeJSON(response, &av); err != nil {
 		return nil, err
 	}
+	c.addSecret(av.UploadToken)
 
 	if opts.File != nil {
-		if err := c.putFile(av.UploadPath, opts.File, opts.FileSize); err != nil {
+		sent, err := c.putFileChecksum(ctx, av.UploadPath, opts.File, opts.FileSize, sum, opts.Upload)
+		if err != nil {
 			return nil, err
 		}
+
+		// Record the checksum of the file in the version's metadata so
+		// that downloads can be verified
+		if !hasSum && sent != "" {
+			if err := c.addArtifactChecksum(ctx, endpoint, &av, sent); err != nil {
+				return &av, &ChecksumRecordError{Version: &av, Checksum: sent, Err: err}
+			}
+		}
 	}
 
 	return &av, nil
 }
 
+// ChecksumRecordError is returned by UploadArtifact, along with the new
+// version, when the file was uploaded but its checksum couldn't be added to
+// the version's metadata afterwards. The version and its file exist, so
+// uploading it again would create another version.
+type ChecksumRecordError struct {
+	Version  *ArtifactVersion
+	Checksum string
+	Err      error
+}
+
+func (e *ChecksumRecordError) Error() string {
+	return fmt.Sprintf("client: artifact version %d was uploaded, but its checksum wasn't recorded: %s",
+		e.Version.Version, e.Err)
+}
+
+// Unwrap returns the error that kept the checksum from being recorded.
+func (e *ChecksumRecordError) Unwrap() error {
+	return e.Err
+}
+
+// checksumMetadata returns a copy of the metadata with the given SHA-256
+// checksum added.
+func checksumMetadata(metadata map[string]string, sum string) map[string]string {
+	result := make(map[string]string, len(metadata)+2)
+	for k, v := range metadata {
+		result[k] = v
+	}
+	result[MetadataChecksumKey] = sum
+	result[MetadataChecksumTypeKey] = "sha256"
+
+	return result
+}
+
+// addArtifactChecksum adds the given SHA-256 checksum to the metadata of the
+// artifact version, which was just created at endpoint.
+func (c *Client) addArtifactChecksum(ctx context.Context, endpoint string, av *ArtifactVersion, sum string) error {
+	metadata := checksumMetadata(av.Metadata, sum)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"artifact_version": map[string]interface{}{
+			"metadata": metadata,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := c.RequestContext(ctx, "PUT", fmt.Sprintf("%s/%d", endpoint, av.Version), &RequestOptions{
+		Body: bytes.NewReader(body),
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return err
+	}
+	discardResp(response)
+
+	av.Metadata = metadata
+	return nil
+}
+
+// metadataChecksum returns the SHA-256 checksum in the metadata, if there
+// is one, and whether there is a checksum of any type.
+func metadataChecksum(metadata map[string]string) (string, bool) {
+	sum, ok := metadata[MetadataChecksumKey]
+	if !ok {
+		return "", false
+	}
+
+	if typ := strings.ToLower(metadata[MetadataChecksumTypeKey]); typ != "" && typ != "sha256" {
+		return "", true
+	}
+
+	return strings.ToLower(sum), true
+}
+
 type artifactWrapper struct {
 	Artifact *Artifact `json:"artifact"`
 }
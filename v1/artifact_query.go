@@ -0,0 +1,199 @@
+package atlas
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ArtifactQuery builds the filters of an artifact search. Filters are
+// added with its methods, which can be chained:
+//
+//	q := NewArtifactQuery().
+//		MetadataEquals("region", "us-east-1").
+//		WithoutMetadata("deprecated").
+//		VersionRange(10, 0).
+//		CreatedAfter(time.Now().AddDate(0, -1, 0))
+//
+// The query is always encoded the same way: metadata filters are numbered
+// in the order they were added, so the same query gives the same URL.
+type ArtifactQuery struct {
+	metadata []metadataFilter
+
+	version    string
+	minVersion int
+	maxVersion int
+	build      string
+
+	createdAfter  time.Time
+	createdBefore time.Time
+}
+
+// metadataFilter is a filter on a single metadata key.
+type metadataFilter struct {
+	key   string
+	value string
+
+	// exact is set if the value must match, rather than the key exist.
+	exact bool
+
+	// negate inverts the filter.
+	negate bool
+}
+
+// NewArtifactQuery returns an empty ArtifactQuery, which matches every
+// version.
+func NewArtifactQuery() *ArtifactQuery {
+	return new(ArtifactQuery)
+}
+
+// HasMetadata matches versions that have the given metadata key, whatever
+// its value.
+func (q *ArtifactQuery) HasMetadata(key string) *ArtifactQuery {
+	q.metadata = append(q.metadata, metadataFilter{key: key})
+	return q
+}
+
+// WithoutMetadata matches versions that don't have the given metadata key.
+func (q *ArtifactQuery) WithoutMetadata(key string) *ArtifactQuery {
+	q.metadata = append(q.metadata, metadataFilter{key: key, negate: true})
+	return q
+}
+
+// MetadataEquals matches versions whose metadata has the given value for
+// the key.
+func (q *ArtifactQuery) MetadataEquals(key, value string) *ArtifactQuery {
+	q.metadata = append(q.metadata, metadataFilter{key: key, value: value, exact: true})
+	return q
+}
+
+// MetadataNotEquals matches versions whose metadata doesn't have the given
+// value for the key, including versions without the key.
+func (q *ArtifactQuery) MetadataNotEquals(key, value string) *ArtifactQuery {
+	q.metadata = append(q.metadata,
+		metadataFilter{key: key, value: value, exact: true, negate: true})
+	return q
+}
+
+// Version matches the given version. It is the same as the Version field
+// of ArtifactSearchOpts.
+func (q *ArtifactQuery) Version(version string) *ArtifactQuery {
+	q.version = version
+	return q
+}
+
+// VersionRange matches versions from min to max, inclusive. Zero leaves
+// that end of the range open.
+func (q *ArtifactQuery) VersionRange(min, max int) *ArtifactQuery {
+	q.minVersion = min
+	q.maxVersion = max
+	return q
+}
+
+// Build matches versions created by the given build.
+func (q *ArtifactQuery) Build(id string) *ArtifactQuery {
+	q.build = id
+	return q
+}
+
+// CreatedAfter matches versions created after the given time.
+func (q *ArtifactQuery) CreatedAfter(t time.Time) *ArtifactQuery {
+	q.createdAfter = t
+	return q
+}
+
+// CreatedBefore matches versions created before the given time.
+func (q *ArtifactQuery) CreatedBefore(t time.Time) *ArtifactQuery {
+	q.createdBefore = t
+	return q
+}
+
+// Values returns the query parameters for the query.
+func (q *ArtifactQuery) Values() url.Values {
+	values := make(url.Values)
+	for k, v := range q.params() {
+		values.Set(k, v)
+	}
+
+	return values
+}
+
+// String returns the encoded query parameters, sorted by key.
+func (q *ArtifactQuery) String() string {
+	return q.Values().Encode()
+}
+
+// params returns the query parameters for the query.
+func (q *ArtifactQuery) params() map[string]string {
+	params := make(map[string]string)
+	for i, f := range q.metadata {
+		prefix := fmt.Sprintf("metadata.%d.", i+1)
+		params[prefix+"key"] = f.key
+		if f.exact {
+			params[prefix+"value"] = f.value
+		}
+		if f.negate {
+			params[prefix+"negate"] = "true"
+		}
+	}
+
+	if q.version != "" {
+		params["version"] = q.version
+	}
+	if q.minVersion > 0 {
+		params["version_min"] = strconv.Itoa(q.minVersion)
+	}
+	if q.maxVersion > 0 {
+		params["version_max"] = strconv.Itoa(q.maxVersion)
+	}
+	if q.build != "" {
+		params["build"] = q.build
+	}
+	if !q.createdAfter.IsZero() {
+		params["created_after"] = q.createdAfter.UTC().Format(time.RFC3339)
+	}
+	if !q.createdBefore.IsZero() {
+		params["created_before"] = q.createdBefore.UTC().Format(time.RFC3339)
+	}
+
+	return params
+}
+
+// query returns the ArtifactQuery for the search options: the Version,
+// Build and Metadata fields, followed by the filters of Query. Metadata is
+// added in the order of its keys.
+func (o *ArtifactSearchOpts) query() *ArtifactQuery {
+	q := NewArtifactQuery().Version(o.Version).Build(o.Build)
+
+	keys := make([]string, 0, len(o.Metadata))
+	for k := range o.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if v := o.Metadata[k]; v == MetadataAnyValue {
+			q.HasMetadata(k)
+		} else {
+			q.MetadataEquals(k, v)
+		}
+	}
+
+	if o.Query != nil {
+		q.metadata = append(q.metadata, o.Query.metadata...)
+		if o.Query.version != "" {
+			q.version = o.Query.version
+		}
+		if o.Query.build != "" {
+			q.build = o.Query.build
+		}
+		q.minVersion = o.Query.minVersion
+		q.maxVersion = o.Query.maxVersion
+		q.createdAfter = o.Query.createdAfter
+		q.createdBefore = o.Query.createdBefore
+	}
+
+	return q
+}
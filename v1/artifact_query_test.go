@@ -0,0 +1,69 @@
+package atlas
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArtifactQuery(t *testing.T) {
+	created := time.Date(2015, 6, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	q := NewArtifactQuery().
+		MetadataEquals("region", "us-east-1").
+		HasMetadata("ready").
+		WithoutMetadata("deprecated").
+		MetadataNotEquals("os", "windows").
+		VersionRange(10, 20).
+		Build("42").
+		CreatedAfter(created).
+		CreatedBefore(created.Add(24 * time.Hour))
+
+	expected := "build=42" +
+		"&created_after=2015-06-01T10%3A00%3A00Z" +
+		"&created_before=2015-06-02T10%3A00%3A00Z" +
+		"&metadata.1.key=region&metadata.1.value=us-east-1" +
+		"&metadata.2.key=ready" +
+		"&metadata.3.key=deprecated&metadata.3.negate=true" +
+		"&metadata.4.key=os&metadata.4.negate=true&metadata.4.value=windows" +
+		"&version_max=20&version_min=10"
+	if actual := q.String(); actual != expected {
+		t.Fatalf("expected %q to be %q", actual, expected)
+	}
+}
+
+func TestArtifactQuery_openRange(t *testing.T) {
+	q := NewArtifactQuery().VersionRange(5, 0)
+
+	expected := "version_min=5"
+	if actual := q.String(); actual != expected {
+		t.Fatalf("expected %q to be %q", actual, expected)
+	}
+}
+
+func TestArtifactSearchOpts_query(t *testing.T) {
+	opts := &ArtifactSearchOpts{
+		Build:   "12",
+		Version: "3",
+		Metadata: map[string]string{
+			"region":  "us-east-1",
+			"arch":    "amd64",
+			"ready":   MetadataAnyValue,
+			"channel": "stable",
+		},
+		Query: NewArtifactQuery().WithoutMetadata("deprecated").Build("13"),
+	}
+
+	// The metadata map is encoded in key order, every time
+	expected := "build=13" +
+		"&metadata.1.key=arch&metadata.1.value=amd64" +
+		"&metadata.2.key=channel&metadata.2.value=stable" +
+		"&metadata.3.key=ready" +
+		"&metadata.4.key=region&metadata.4.value=us-east-1" +
+		"&metadata.5.key=deprecated&metadata.5.negate=true" +
+		"&version=3"
+	for i := 0; i < 10; i++ {
+		if actual := opts.query().String(); actual != expected {
+			t.Fatalf("expected %q to be %q", actual, expected)
+		}
+	}
+}
@@ -2,6 +2,11 @@ package atlas
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -166,3 +171,361 @@ func TestUploadArtifact(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestUploadArtifactContext_canceled(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	data := bytes.NewBufferString("hello")
+	_, err = client.UploadArtifactContext(ctx, &UploadArtifactOpts{
+		User:     "hashicorp",
+		Name:     "existing",
+		Type:     "amazon-ami",
+		File:     data,
+		FileSize: int64(data.Len()),
+	})
+	if err == nil {
+		t.Fatal("expected error, but nothing was returned")
+	}
+}
+
+func TestUploadArtifact_checksum(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.NewReader([]byte("hello"))
+	av, err := client.UploadArtifact(&UploadArtifactOpts{
+		User:     "hashicorp",
+		Name:     "existing",
+		Type:     "amazon-ami",
+		File:     data,
+		FileSize: data.Size(),
+		Metadata: map[string]string{"foo": "bar"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"foo":                   "bar",
+		MetadataChecksumKey:     "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		MetadataChecksumTypeKey: "sha256",
+	}
+	if !reflect.DeepEqual(av.Metadata, expected) {
+		t.Fatalf("bad: %#v", av.Metadata)
+	}
+}
+
+// countingReader counts the bytes read from a bytes.Reader.
+type countingReader struct {
+	*bytes.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func TestUploadArtifact_contentMD5(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The "md5" storage requires the Content-MD5
+	data := &countingReader{Reader: bytes.NewReader([]byte("hello"))}
+	av, err := client.UploadArtifact(&UploadArtifactOpts{
+		User:     "hashicorp",
+		Name:     "existing",
+		Type:     "amazon-ami",
+		ID:       "md5",
+		File:     data,
+		FileSize: data.Size(),
+		Upload:   &UploadOptions{ContentMD5: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Once for the checksum, once for the Content-MD5 and once to upload it
+	if data.n != 15 {
+		t.Fatalf("expected the file to be read three times, read %d bytes", data.n)
+	}
+
+	// The checksum was sent with the new version
+	sum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if av.Metadata[MetadataChecksumKey] != sum {
+		t.Fatalf("bad: %#v", av.Metadata)
+	}
+	if metadata, ok := server.metadata["/api/v1/artifacts/hashicorp/existing/amazon-ami/1"]; ok {
+		t.Fatalf("expected no metadata update, got %#v", metadata)
+	}
+}
+
+func TestUploadArtifact_notSeekable(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := &countingReader{Reader: bytes.NewReader([]byte("hello"))}
+	av, err := client.UploadArtifact(&UploadArtifactOpts{
+		User:     "hashicorp",
+		Name:     "existing",
+		Type:     "amazon-ami",
+		File:     struct{ io.Reader }{data},
+		FileSize: data.Size(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data.n != 5 {
+		t.Fatalf("expected the file to be read once, read %d bytes", data.n)
+	}
+
+	// The checksum is only known after the upload, so it's added then
+	sum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if av.Metadata[MetadataChecksumKey] != sum {
+		t.Fatalf("bad: %#v", av.Metadata)
+	}
+	metadata := server.metadata["/api/v1/artifacts/hashicorp/existing/amazon-ami/1"]
+	if metadata[MetadataChecksumKey] != sum {
+		t.Fatalf("expected the checksum to be recorded, got %#v", metadata)
+	}
+}
+
+func TestUploadArtifact_checksumNotRecorded(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// There's no version to add the checksum to
+	av, err := client.UploadArtifact(&UploadArtifactOpts{
+		User:     "hashicorp",
+		Name:     "unrecorded",
+		Type:     "amazon-ami",
+		File:     struct{ io.Reader }{strings.NewReader("hello")},
+		FileSize: 5,
+	})
+
+	var recordErr *ChecksumRecordError
+	if !errors.As(err, &recordErr) {
+		t.Fatalf("expected *ChecksumRecordError, got %#v", err)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %s to be ErrNotFound", err)
+	}
+	if av == nil || av.Version != 1 || recordErr.Version != av {
+		t.Fatalf("expected the new version to be returned, got %#v", av)
+	}
+	if uploads := server.uploadedBodies(); len(uploads) != 1 || uploads[0] != "hello" {
+		t.Fatalf("bad: %#v", uploads)
+	}
+}
+
+func TestUploadArtifact_uploadOptions(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress := new(testProgress)
+	data := bytes.NewReader([]byte("hello"))
+	_, err = client.UploadArtifact(&UploadArtifactOpts{
+		User:     "hashicorp",
+		Name:     "existing",
+		Type:     "amazon-ami",
+		File:     data,
+		FileSize: data.Size(),
+		Upload:   &UploadOptions{Progress: progress.report},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := progress.last()
+	if last.Bytes != 5 || last.Total != 5 {
+		t.Fatalf("bad: %#v", last)
+	}
+}
+
+func TestUploadArtifact_checksumMismatch(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.NewReader([]byte("hello"))
+	_, err = client.UploadArtifact(&UploadArtifactOpts{
+		User:     "hashicorp",
+		Name:     "existing",
+		Type:     "amazon-ami",
+		ID:       "corrupt",
+		File:     data,
+		FileSize: data.Size(),
+	})
+
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("expected *ChecksumError, got %#v", err)
+	}
+	if checksumErr.Type != "sha256" {
+		t.Fatalf("expected %q to be %q", checksumErr.Type, "sha256")
+	}
+}
+
+func TestArtifactVersion(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	av, err := client.ArtifactVersion("hashicorp", "existing", "vagrant-box", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if av.Version != 1 {
+		t.Fatalf("expected %d to be %d", av.Version, 1)
+	}
+	if av.Type != "vagrant-box" {
+		t.Fatalf("expected %q to be %q", av.Type, "vagrant-box")
+	}
+}
+
+func TestArtifactVersion_notFound(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.ArtifactVersion("hashicorp", "existing", "vagrant-box", 3)
+
+	var notFound *ArtifactVersionNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected *ArtifactVersionNotFoundError, got %#v", err)
+	}
+	if notFound.Version != 3 {
+		t.Fatalf("expected %d to be %d", notFound.Version, 3)
+	}
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %s to be ErrNotFound", err)
+	}
+}
+
+func TestLatestArtifactVersion(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	av, err := client.LatestArtifactVersion("hashicorp", "existing", "vagrant-box")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if av.Version != 2 {
+		t.Fatalf("expected %d to be %d", av.Version, 2)
+	}
+
+	_, err = client.LatestArtifactVersion("hashicorp", "missing", "vagrant-box")
+	var notFound *ArtifactVersionNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected *ArtifactVersionNotFoundError, got %#v", err)
+	}
+}
+
+func TestDeleteArtifactVersion(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.DeleteArtifactVersion("hashicorp", "existing", "vagrant-box", 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeleteArtifactVersion_inUse(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.DeleteArtifactVersion("hashicorp", "existing", "vagrant-box", 2)
+
+	var inUse *ArtifactVersionInUseError
+	if !errors.As(err, &inUse) {
+		t.Fatalf("expected *ArtifactVersionInUseError, got %#v", err)
+	}
+
+	var railsErr *RailsError
+	if !errors.As(err, &railsErr) {
+		t.Fatalf("expected *RailsError, got %#v", err)
+	}
+	if railsErr.Error() != "version is used by build 12" {
+		t.Fatalf("expected %q to be %q", railsErr.Error(), "version is used by build 12")
+	}
+}
+
+func TestDeleteArtifactVersion_notFound(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.DeleteArtifactVersion("hashicorp", "existing", "vagrant-box", 3)
+	var notFound *ArtifactVersionNotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected *ArtifactVersionNotFoundError, got %#v", err)
+	}
+}
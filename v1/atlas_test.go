@@ -2,6 +2,10 @@ package atlas
 
 import (
 	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,7 +17,9 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type atlasServer struct {
@@ -22,6 +28,33 @@ type atlasServer struct {
 	t      *testing.T
 	ln     net.Listener
 	server *http.Server
+
+	// attempts counts the requests made to the flaky handlers, by path
+	attemptsLock sync.Mutex
+	attempts     map[string]int
+
+	// uploads records the bodies received by the binstores, and the files
+	// assembled by the chunked binstore
+	uploads []string
+
+	// chunks holds the chunks received by the chunked binstore, by path
+	// and offset
+	chunks map[string]map[int64][]byte
+
+	// state and stateLock are the Terraform state of hashicorp/existing and
+	// the lock held on it, if any
+	state     []byte
+	stateLock *LockInfo
+
+	// flakyStateLock is the lock held on the state of hashicorp/flaky
+	flakyStateLock *LockInfo
+
+	// tfVars are the variables of the hashicorp/existing environment
+	tfVars map[string]TFVar
+
+	// metadata records the metadata set on uploaded artifact versions, by
+	// path
+	metadata map[string]map[string]string
 }
 
 type clientTestResp struct {
@@ -32,7 +65,17 @@ type clientTestResp struct {
 }
 
 func newTestAtlasServer(t *testing.T) *atlasServer {
-	hs := &atlasServer{t: t}
+	hs := &atlasServer{
+		t:        t,
+		attempts: make(map[string]int),
+		chunks:   make(map[string]map[int64][]byte),
+		metadata: make(map[string]map[string]string),
+		tfVars: map[string]TFVar{
+			"region": {Key: "region", Value: "us-east-1"},
+			"token":  {Key: "token", Value: "hunter2", Sensitive: true},
+			"zones":  {Key: "zones", Value: `["a", "b"]`, IsHCL: true},
+		},
+	}
 
 	ln, err := net.Listen("tcp", ":0")
 	if err != nil {
@@ -63,30 +106,70 @@ func (hs *atlasServer) Stop() {
 
 func (hs *atlasServer) setupRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/_json", hs.jsonHandler)
+	mux.HandleFunc("/_large", hs.largeHandler)
+	mux.HandleFunc("/_large-json", hs.largeJSONHandler)
 	mux.HandleFunc("/_rails-error", hs.railsHandler)
 	mux.HandleFunc("/_status/", hs.statusHandler)
 
+	mux.HandleFunc("/_flaky/", hs.flakyHandler)
+
 	mux.HandleFunc("/_binstore/", hs.binstoreHandler)
+	mux.HandleFunc("/_binstore-flaky/", hs.flakyBinstoreHandler)
+	mux.HandleFunc("/_binstore-chunked/", hs.chunkedBinstoreHandler)
 
 	mux.HandleFunc("/api/v1/authenticate", hs.authenticationHandler)
 	mux.HandleFunc("/api/v1/token", hs.tokenHandler)
 
 	mux.HandleFunc("/api/v1/artifacts/hashicorp/existing", hs.vagrantArtifactExistingHandler)
 	mux.HandleFunc("/api/v1/artifacts/hashicorp/existing/amazon-ami", hs.vagrantArtifactUploadHandler)
+	mux.HandleFunc("/api/v1/artifacts/hashicorp/promoted/vagrant-box", hs.vagrantArtifactUploadHandler)
+	mux.HandleFunc("/api/v1/artifacts/hashicorp/unrecorded/amazon-ami", hs.vagrantArtifactUploadHandler)
+	mux.HandleFunc("/api/v1/artifacts/hashicorp/existing/amazon-ami/1", hs.artifactMetadataHandler)
+	mux.HandleFunc("/api/v1/artifacts/hashicorp/promoted/vagrant-box/1", hs.artifactMetadataHandler)
 	mux.HandleFunc("/api/v1/artifacts/hashicorp/existing1/amazon-ami/search", hs.vagrantArtifactSearchHandler1)
 	mux.HandleFunc("/api/v1/artifacts/hashicorp/existing2/amazon-ami/search", hs.vagrantArtifactSearchHandler2)
+	mux.HandleFunc("/api/v1/artifacts/hashicorp/paged/amazon-ami/search", hs.pagedArtifactSearchHandler)
+	mux.HandleFunc("/api/v1/artifacts/hashicorp/amis/amazon.ami/search", hs.amiSearchHandler)
+	mux.HandleFunc("/api/v1/artifacts/hashicorp/cached/amazon-ami/search", hs.etagSearchHandler)
+	mux.HandleFunc("/api/v1/artifacts/hashicorp/paged-nolink/amazon-ami/search", hs.pagedArtifactSearchHandler)
+	mux.HandleFunc("/api/v1/artifacts/hashicorp/unpaged/amazon.ami/search", hs.pagedArtifactSearchHandler)
+
+	mux.HandleFunc("/api/v1/artifacts/hashicorp/existing/vagrant-box/1/file", hs.artifactFileHandler)
+	mux.HandleFunc("/api/v1/artifacts/hashicorp/existing/vagrant-box/2/file", hs.artifactFileHandler)
+	mux.HandleFunc("/api/v1/artifacts/hashicorp/existing/vagrant-box/4/file", hs.artifactFileHandler)
+	mux.HandleFunc("/_storage/", hs.storageHandler)
+
+	mux.HandleFunc("/api/v1/artifacts/hashicorp/existing/vagrant-box/1", hs.artifactVersionHandler)
+	mux.HandleFunc("/api/v1/artifacts/hashicorp/existing/vagrant-box/2", hs.artifactVersionHandler)
+	mux.HandleFunc("/api/v1/artifacts/hashicorp/existing/vagrant-box/latest", hs.artifactVersionHandler)
 
 	mux.HandleFunc("/api/v1/vagrant/applications", hs.vagrantCreateAppHandler)
 	mux.HandleFunc("/api/v1/vagrant/applications/", hs.vagrantCreateAppsHandler)
 	mux.HandleFunc("/api/v1/vagrant/applications/hashicorp/existing", hs.vagrantAppExistingHandler)
 	mux.HandleFunc("/api/v1/vagrant/applications/hashicorp/existing/versions", hs.vagrantUploadAppHandler)
+	mux.HandleFunc("/api/v1/vagrant/applications/hashicorp/existing/versions/", hs.vagrantAppVersionHandler)
+	mux.HandleFunc("/api/v1/vagrant/applications/hashicorp/chunked/versions", hs.vagrantUploadAppChunkedHandler)
 
 	mux.HandleFunc("/api/v1/packer/build-configurations", hs.vagrantBCCreateHandler)
 	mux.HandleFunc("/api/v1/packer/build-configurations/hashicorp/existing", hs.vagrantBCExistingHandler)
 	mux.HandleFunc("/api/v1/packer/build-configurations/hashicorp/existing/versions", hs.vagrantBCCreateVersionHandler)
+	mux.HandleFunc("/api/v1/packer/build-configurations/hashicorp/existing/versions/", hs.vagrantBCVersionHandler)
+	mux.HandleFunc("/api/v1/packer/build-configurations/hashicorp/existing/builds", hs.buildsHandler)
+	mux.HandleFunc("/api/v1/packer/build-configurations/hashicorp/existing/builds/", hs.buildHandler)
 
 	mux.HandleFunc("/api/v1/terraform/configurations/hashicorp/existing/versions/latest", hs.tfConfigLatest)
 	mux.HandleFunc("/api/v1/terraform/configurations/hashicorp/existing/versions", hs.tfConfigUpload)
+	mux.HandleFunc("/api/v1/terraform/configurations/hashicorp/existing/versions/", hs.tfConfigVersion)
+	mux.HandleFunc("/api/v1/terraform/configurations/hashicorp/empty", hs.tfConfigEmpty)
+	mux.HandleFunc("/api/v1/terraform/environments/hashicorp/existing/runs", hs.tfRunsHandler)
+	mux.HandleFunc("/api/v1/terraform/environments/hashicorp/existing/variables", hs.tfVarsHandler)
+	mux.HandleFunc("/api/v1/terraform/environments/hashicorp/existing/variables/", hs.tfVarHandler)
+	mux.HandleFunc("/api/v1/terraform/state/hashicorp/existing", hs.tfStateHandler)
+	mux.HandleFunc("/api/v1/terraform/state/hashicorp/existing/lock", hs.tfStateLockHandler)
+	mux.HandleFunc("/api/v1/terraform/state/hashicorp/corrupt", hs.tfStateCorruptHandler)
+	mux.HandleFunc("/api/v1/terraform/state/hashicorp/flaky/lock", hs.tfStateFlakyLockHandler)
+	mux.HandleFunc("/api/v1/terraform/environments/hashicorp/existing/runs/", hs.tfRunHandler)
+	mux.HandleFunc("/api/v1/terraform/configurations/hashicorp/empty/versions", hs.tfConfigEmptyVersions)
 
 	// add an endpoint for testing arbitrary requests
 	mux.HandleFunc("/_test", hs.testHandler)
@@ -129,12 +212,166 @@ func (hs *atlasServer) statusHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(int(code))
 }
 
+// attempt records a request to the given path and returns how many
+// requests have been made to it, including this one.
+func (hs *atlasServer) attempt(path string) int {
+	hs.attemptsLock.Lock()
+	defer hs.attemptsLock.Unlock()
+	hs.attempts[path]++
+	return hs.attempts[path]
+}
+
+// attemptCount returns how many requests have been made to the given path.
+func (hs *atlasServer) attemptCount(path string) int {
+	hs.attemptsLock.Lock()
+	defer hs.attemptsLock.Unlock()
+	return hs.attempts[path]
+}
+
+// uploadedBodies returns the bodies received by the binstores.
+func (hs *atlasServer) uploadedBodies() []string {
+	hs.attemptsLock.Lock()
+	defer hs.attemptsLock.Unlock()
+	return append([]string(nil), hs.uploads...)
+}
+
+// flakyHandler fails requests to /_flaky/<n> with a 503 the first n times.
+func (hs *atlasServer) flakyHandler(w http.ResponseWriter, r *http.Request) {
+	slice := strings.Split(r.URL.Path, "/")
+	failures, err := strconv.Atoi(slice[len(slice)-1])
+	if err != nil {
+		hs.t.Fatal(err)
+	}
+
+	if hs.attempt(r.URL.Path) <= failures {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"ok": true}`)
+}
+
+// flakyBinstoreHandler fails the first upload with a 502 and records the
+// body of every upload.
+func (hs *atlasServer) flakyBinstoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		hs.t.Fatal(err)
+	}
+
+	hs.attemptsLock.Lock()
+	hs.uploads = append(hs.uploads, string(body))
+	hs.attemptsLock.Unlock()
+
+	if hs.attempt(r.URL.Path) == 1 {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// chunkedBinstoreHandler accepts chunked uploads, assembling the file once
+// the upload is completed. Uploads to /_binstore-chunked/fail-<offset> fail
+// the first attempt at the chunk starting at that offset.
+func (hs *atlasServer) chunkedBinstoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		hs.t.Fatal(err)
+	}
+
+	var first, last, total int64
+	cr := r.Header.Get("Content-Range")
+	if _, err := fmt.Sscanf(cr, "bytes */%d", &total); err == nil {
+		hs.assembleChunks(w, r.URL.Path, total)
+		return
+	}
+	if _, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &first, &last, &total); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if int64(len(body)) != last-first+1 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	attempt := hs.attempt(fmt.Sprintf("%s@%d", r.URL.Path, first))
+	if strings.HasSuffix(r.URL.Path, fmt.Sprintf("/fail-%d", first)) && attempt == 1 {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	hs.attemptsLock.Lock()
+	if hs.chunks[r.URL.Path] == nil {
+		hs.chunks[r.URL.Path] = make(map[int64][]byte)
+	}
+	hs.chunks[r.URL.Path][first] = body
+	hs.attemptsLock.Unlock()
+
+	sum := sha256.Sum256(body)
+	w.Header().Set(StorageChecksumHeader, hex.EncodeToString(sum[:]))
+	w.WriteHeader(http.StatusOK)
+}
+
+// assembleChunks joins the chunks uploaded to the given path, failing if
+// any are missing.
+func (hs *atlasServer) assembleChunks(w http.ResponseWriter, path string, total int64) {
+	hs.attemptsLock.Lock()
+	defer hs.attemptsLock.Unlock()
+
+	var file []byte
+	for int64(len(file)) < total {
+		chunk, ok := hs.chunks[path][int64(len(file))]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		file = append(file, chunk...)
+	}
+	if int64(len(file)) != total {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	hs.uploads = append(hs.uploads, string(file))
+
+	sum := sha256.Sum256(file)
+	w.Header().Set(StorageChecksumHeader, hex.EncodeToString(sum[:]))
+	w.WriteHeader(http.StatusOK)
+}
+
 func (hs *atlasServer) railsHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(422)
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", "abc123")
+	w.WriteHeader(422)
 	fmt.Fprintf(w, `{"errors": ["this is an error", "this is another error"]}`)
 }
 
+// largeHandler writes a body larger than the client logs.
+func (hs *atlasServer) largeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write(bytes.Repeat([]byte("a"), maxLogBodySize*2))
+}
+
+// largeJSONHandler writes a JSON body with a token that is larger than the
+// client logs.
+func (hs *atlasServer) largeJSONHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, `{"token": "s3cr3t-token", "padding": "%s"}`,
+		bytes.Repeat([]byte("a"), maxLogBodySize))
+}
+
 func (hs *atlasServer) jsonHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	fmt.Fprintf(w, `{"ok": true}`)
@@ -191,6 +428,11 @@ func (hs *atlasServer) tfConfigLatest(w http.ResponseWriter, r *http.Request) {
 }
 
 func (hs *atlasServer) tfConfigUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		hs.tfConfigVersions(w, r)
+		return
+	}
+
 	if r.Method != "POST" {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
@@ -218,6 +460,341 @@ func (hs *atlasServer) tfConfigUpload(w http.ResponseWriter, r *http.Request) {
 	`, uploadPath)
 }
 
+// tfConfigVersions lists versions 4 and 5 of hashicorp/existing.
+func (hs *atlasServer) tfConfigVersions(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, `
+	{
+		"versions": [
+			{ "version": 4, "metadata": { "foo": "baz" } },
+			{ "version": 5, "metadata": { "foo": "bar" } }
+		]
+	}
+	`)
+}
+
+// tfConfigVersion serves versions 4 and 5 of hashicorp/existing and their
+// slugs, which redirect to the storage.
+func (hs *atlasServer) tfConfigVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var version int
+	var slug string
+	fmt.Sscanf(strings.TrimPrefix(r.URL.Path,
+		"/api/v1/terraform/configurations/hashicorp/existing/versions/"), "%d/%s", &version, &slug)
+	if version != 4 && version != 5 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch slug {
+	case "slug":
+		http.Redirect(w, r, hs.URL.String()+"/_storage/slug", http.StatusFound)
+	case "":
+		fmt.Fprintf(w, `{ "version": { "version": %d } }`, version)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// tfConfigEmpty serves hashicorp/empty, a configuration without versions.
+func (hs *atlasServer) tfConfigEmpty(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, `{ "username": "hashicorp", "name": "empty" }`)
+}
+
+func (hs *atlasServer) tfConfigEmptyVersions(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, `{ "versions": [] }`)
+}
+
+// testPlanLog is the plan log of run 7.
+const testPlanLog = "Refreshing state...\n+ aws_instance.web\nPlan: 1 to add, 2 to change, 0 to destroy.\n"
+
+// tfRunsHandler queues run 7 of hashicorp/existing.
+func (hs *atlasServer) tfRunsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var wrapper struct {
+		Run struct {
+			ConfigVersion int    `json:"configuration_version"`
+			Message       string `json:"message"`
+			Destroy       bool   `json:"is_destroy"`
+		} `json:"run"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&wrapper); err != nil {
+		hs.t.Fatal(err)
+	}
+
+	fmt.Fprintf(w, `
+	{
+		"run": {
+			"id": 7,
+			"configuration_version": %d,
+			"status": "pending",
+			"message": %q,
+			"is_destroy": %t
+		}
+	}
+	`, wrapper.Run.ConfigVersion, wrapper.Run.Message, wrapper.Run.Destroy)
+}
+
+// tfRunHandler serves runs 7 and 8 of hashicorp/existing. Run 7 is planning
+// for the first two requests and planned after that, until it is confirmed
+// or discarded. Its plan log is served one line per request. Run 8 was
+// applied already.
+func (hs *atlasServer) tfRunHandler(w http.ResponseWriter, r *http.Request) {
+	var id int
+	var rest string
+	fmt.Sscanf(strings.TrimPrefix(r.URL.Path,
+		"/api/v1/terraform/environments/hashicorp/existing/runs/"), "%d/%s", &id, &rest)
+
+	runPath := "/api/v1/terraform/environments/hashicorp/existing/runs/7"
+	switch {
+	case id == 7 && rest == "" && r.Method == "GET":
+		status := "planning"
+		switch {
+		case hs.attemptCount(runPath+"/confirm") > 0:
+			status = "applied"
+		case hs.attemptCount(runPath+"/discard") > 0:
+			status = "discarded"
+		case hs.attempt(r.URL.Path) > 2:
+			status = "planned"
+		}
+
+		fmt.Fprintf(w, `
+		{
+			"run": {
+				"id": 7,
+				"configuration_version": 5,
+				"status": %q,
+				"plan": { "has_changes": true, "additions": 1, "changes": 2, "destructions": 0 }
+			}
+		}
+		`, status)
+	case id == 7 && (rest == "confirm" || rest == "discard") && r.Method == "POST":
+		hs.attempt(r.URL.Path)
+
+		status := "confirmed"
+		if rest == "discard" {
+			status = "discarded"
+		}
+		fmt.Fprintf(w, `{ "run": { "id": 7, "status": %q } }`, status)
+	case id == 7 && rest == "plan/log" && r.Method == "GET":
+		log := testPlanLog
+		if v := r.URL.Query().Get("offset"); v != "" {
+			offset, err := strconv.Atoi(v)
+			if err != nil || offset > len(testPlanLog) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			log = testPlanLog[offset:]
+			if i := strings.Index(log, "\n"); i >= 0 {
+				log = log[:i+1]
+			}
+		}
+		io.WriteString(w, log)
+	case id == 8 && rest == "" && r.Method == "GET":
+		fmt.Fprintf(w, `{ "run": { "id": 8, "status": "applied" } }`)
+	case id == 8 && (rest == "confirm" || rest == "discard") && r.Method == "POST":
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprintf(w, `{ "errors": ["run is not waiting for confirmation"] }`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// tfStateHandler serves the state of hashicorp/existing, which can only be
+// changed with the ID of the lock if it is locked.
+func (hs *atlasServer) tfStateHandler(w http.ResponseWriter, r *http.Request) {
+	hs.attemptsLock.Lock()
+	defer hs.attemptsLock.Unlock()
+
+	if r.Method != "GET" && !hs.checkStateLock(w, r.URL.Query().Get("lock_id")) {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		if hs.state == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		sum := md5.Sum(hs.state)
+		w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+		w.Write(hs.state)
+	case "PUT":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			hs.t.Fatal(err)
+		}
+
+		sum := md5.Sum(body)
+		if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		hs.state = body
+	case "DELETE":
+		hs.state = nil
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// tfStateLockHandler serves the lock on the state of hashicorp/existing.
+func (hs *atlasServer) tfStateLockHandler(w http.ResponseWriter, r *http.Request) {
+	hs.attemptsLock.Lock()
+	defer hs.attemptsLock.Unlock()
+
+	switch r.Method {
+	case "GET":
+		if hs.stateLock == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		json.NewEncoder(w).Encode(hs.stateLock)
+	case "PUT":
+		var info LockInfo
+		if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+			hs.t.Fatal(err)
+		}
+
+		if !hs.checkStateLock(w, info.ID) {
+			return
+		}
+
+		hs.stateLock = &info
+	case "DELETE":
+		if r.URL.Query().Get("force") != "true" && !hs.checkStateLock(w, r.URL.Query().Get("lock_id")) {
+			return
+		}
+
+		hs.stateLock = nil
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// tfStateFlakyLockHandler locks the state of hashicorp/flaky, but drops the
+// connection instead of responding to the request that takes the lock. Like
+// Atlas, it responds with a 423 to any request for a lock that is held.
+func (hs *atlasServer) tfStateFlakyLockHandler(w http.ResponseWriter, r *http.Request) {
+	hs.attemptsLock.Lock()
+	defer hs.attemptsLock.Unlock()
+
+	if r.Method != "PUT" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if hs.flakyStateLock != nil {
+		w.WriteHeader(http.StatusLocked)
+		json.NewEncoder(w).Encode(hs.flakyStateLock)
+		return
+	}
+
+	var info LockInfo
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		hs.t.Fatal(err)
+	}
+	hs.flakyStateLock = &info
+
+	panic(http.ErrAbortHandler)
+}
+
+// checkStateLock responds with a 423 and the lock info if the state is
+// locked with an ID other than the given one.
+func (hs *atlasServer) checkStateLock(w http.ResponseWriter, id string) bool {
+	if hs.stateLock == nil || hs.stateLock.ID == id {
+		return true
+	}
+
+	w.WriteHeader(http.StatusLocked)
+	json.NewEncoder(w).Encode(hs.stateLock)
+	return false
+}
+
+// tfStateCorruptHandler serves a state with the wrong MD5 checksum.
+func (hs *atlasServer) tfStateCorruptHandler(w http.ResponseWriter, r *http.Request) {
+	sum := md5.Sum([]byte("{}"))
+	w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	w.Write([]byte(`{"version": 3}`))
+}
+
+// tfVarsHandler lists and creates the variables of hashicorp/existing. Like
+// a careless server, it returns the values of sensitive variables.
+func (hs *atlasServer) tfVarsHandler(w http.ResponseWriter, r *http.Request) {
+	hs.attemptsLock.Lock()
+	defer hs.attemptsLock.Unlock()
+
+	switch r.Method {
+	case "GET":
+		var wrapper tfVarsWrapper
+		for _, v := range hs.tfVars {
+			wrapper.Variables = append(wrapper.Variables, v)
+		}
+		json.NewEncoder(w).Encode(&wrapper)
+	case "POST":
+		var wrapper tfVarWrapper
+		if err := json.NewDecoder(r.Body).Decode(&wrapper); err != nil {
+			hs.t.Fatal(err)
+		}
+
+		v := *wrapper.Variable
+		if _, ok := hs.tfVars[v.Key]; ok {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		hs.tfVars[v.Key] = v
+		json.NewEncoder(w).Encode(&tfVarWrapper{Variable: &v})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// tfVarHandler serves a single variable of hashicorp/existing.
+func (hs *atlasServer) tfVarHandler(w http.ResponseWriter, r *http.Request) {
+	hs.attemptsLock.Lock()
+	defer hs.attemptsLock.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/api/v1/terraform/environments/hashicorp/existing/variables/")
+	v, ok := hs.tfVars[key]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(&tfVarWrapper{Variable: &v})
+	case "PUT":
+		var wrapper tfVarWrapper
+		if err := json.NewDecoder(r.Body).Decode(&wrapper); err != nil {
+			hs.t.Fatal(err)
+		}
+
+		v = *wrapper.Variable
+		hs.tfVars[key] = v
+		json.NewEncoder(w).Encode(&tfVarWrapper{Variable: &v})
+	case "DELETE":
+		delete(hs.tfVars, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
 func (hs *atlasServer) vagrantArtifactExistingHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -283,6 +860,78 @@ func (hs *atlasServer) vagrantArtifactSearchHandler2(w http.ResponseWriter, r *h
 	`)
 }
 
+// pagedArtifactSearchHandler pages through 5 versions. Searches of
+// "paged" have a Link header pointing to the next page, searches of
+// "paged-nolink" don't, and searches of "unpaged" ignore the page and always
+// return the first one, with AMIs in us-east-1.
+func (hs *atlasServer) pagedArtifactSearchHandler(w http.ResponseWriter, r *http.Request) {
+	hs.attempt(r.URL.Path)
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if strings.Contains(r.URL.Path, "/unpaged/") {
+		page = 1
+	}
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var versions []*ArtifactVersion
+	for v := (page-1)*perPage + 1; v <= page*perPage && v <= 5; v++ {
+		av := &ArtifactVersion{Version: v}
+		if strings.Contains(r.URL.Path, "/unpaged/") {
+			av.ID = fmt.Sprintf("us-east-1:ami-%d", v)
+		}
+		versions = append(versions, av)
+	}
+
+	if strings.Contains(r.URL.Path, "/paged/") {
+		w.Header().Add("Link", fmt.Sprintf(`<%s?page=1>; rel="first"`, r.URL.Path))
+		if page*perPage < 5 {
+			w.Header().Add("Link", fmt.Sprintf(`<%s?page=%d>; rel="next"`, r.URL.Path, page+1))
+		}
+	}
+
+	json.NewEncoder(w).Encode(&artifactSearchWrapper{Versions: versions})
+}
+
+// amiSearchHandler returns amazon.ami versions, out of order. Searches for
+// metadata other than "channel" find nothing.
+func (hs *atlasServer) amiSearchHandler(w http.ResponseWriter, r *http.Request) {
+	var versions []*ArtifactVersion
+	if key := r.URL.Query().Get("metadata.1.key"); key == "" || key == "channel" {
+		versions = []*ArtifactVersion{
+			{Version: 3, ID: "us-east-1:ami-3333"},
+			{Version: 5, ID: "us-east-1:ami-5555,us-west-2:ami-5656"},
+			{Version: 4, ID: "us-east-1:ami-4444,us-west-2:ami-4646"},
+		}
+	}
+
+	json.NewEncoder(w).Encode(&artifactSearchWrapper{Versions: versions})
+}
+
+// etagSearchHandler returns a version with an ETag, and a 304 if the
+// client already has it. The 304s are counted under "<path>#304".
+func (hs *atlasServer) etagSearchHandler(w http.ResponseWriter, r *http.Request) {
+	hs.attempt(r.URL.Path)
+
+	w.Header().Set("ETag", `"v1"`)
+	if r.Header.Get("If-None-Match") == `"v1"` {
+		hs.attempt(r.URL.Path + "#304")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&artifactSearchWrapper{
+		Versions: []*ArtifactVersion{{Version: 1}},
+	})
+}
+
 func (hs *atlasServer) vagrantArtifactUploadHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -300,14 +949,141 @@ func (hs *atlasServer) vagrantArtifactUploadHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
-	uploadPath := hs.URL.String() + "/_binstore/"
+	var req struct {
+		Version struct {
+			ID       string            `json:"id"`
+			Metadata map[string]string `json:"metadata"`
+		} `json:"artifact_version"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// The ID picks the binstore, so tests can upload to a corrupt one
+	uploadPath := hs.URL.String() + "/_binstore/" + req.Version.ID
+
+	body, err := json.Marshal(&ArtifactVersion{
+		Version:    1,
+		UploadPath: uploadPath,
+		Metadata:   req.Version.Metadata,
+	})
+	if err != nil {
+		hs.t.Fatal(err)
+	}
 
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `
-	{
-		"upload_path": "%s"
+	w.Write(body)
+}
+
+// artifactMetadataHandler records the metadata set on version 1 of an
+// uploaded artifact.
+func (hs *atlasServer) artifactMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "PUT" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
 	}
-	`, uploadPath)
+
+	var req struct {
+		Version struct {
+			Metadata map[string]string `json:"metadata"`
+		} `json:"artifact_version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	hs.attemptsLock.Lock()
+	hs.metadata[r.URL.Path] = req.Version.Metadata
+	hs.attemptsLock.Unlock()
+
+	json.NewEncoder(w).Encode(&ArtifactVersion{
+		Version:  1,
+		Metadata: req.Version.Metadata,
+	})
+}
+
+// artifactVersionHandler serves versions 1 and 2 of hashicorp/existing, 2
+// being the latest. Version 2 is in use, so it can't be deleted.
+func (hs *atlasServer) artifactVersionHandler(w http.ResponseWriter, r *http.Request) {
+	version := 2
+	if strings.HasSuffix(r.URL.Path, "/1") {
+		version = 1
+	}
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(&artifactVersionWrapper{&ArtifactVersion{
+			User:    "hashicorp",
+			Name:    "existing",
+			Type:    "vagrant-box",
+			Version: version,
+		}})
+	case "DELETE":
+		if version == 2 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprintf(w, `{"errors": ["version is used by build 12"]}`)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// testArtifactFile is the content of the artifact files served by
+// storageHandler.
+var testArtifactFile = bytes.Repeat([]byte("0123456789"), 10000)
+
+// artifactFileHandler redirects to the storage for the file, like Atlas
+// does. Version 1 is stored in "box", version 2 in "flaky-box" and version 4
+// in "streamed-box".
+func (hs *atlasServer) artifactFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(atlasTokenHeader) == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	hs.attempt(r.URL.Path)
+
+	name := "box"
+	switch {
+	case strings.Contains(r.URL.Path, "/2/"):
+		name = "flaky-box"
+	case strings.Contains(r.URL.Path, "/4/"):
+		name = "streamed-box"
+	}
+
+	http.Redirect(w, r, hs.URL.String()+"/_storage/"+name, http.StatusFound)
+}
+
+// storageHandler serves testArtifactFile, supporting Range requests. The
+// first full request for "flaky-box" is cut off half way through, and
+// "streamed-box" is sent without a Content-Length.
+func (hs *atlasServer) storageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(atlasTokenHeader) != "" {
+		hs.t.Error("token was sent to the storage backend")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/flaky-box") && r.Header.Get("Range") == "" &&
+		hs.attempt(r.URL.Path) == 1 {
+		w.Header().Set("Content-Length", strconv.Itoa(len(testArtifactFile)))
+		w.Write(testArtifactFile[:len(testArtifactFile)/2])
+		panic(http.ErrAbortHandler)
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/streamed-box") {
+		half := len(testArtifactFile) / 2
+		w.Write(testArtifactFile[:half])
+		w.(http.Flusher).Flush()
+		w.Write(testArtifactFile[half:])
+		return
+	}
+
+	http.ServeContent(w, r, "box", time.Time{}, bytes.NewReader(testArtifactFile))
 }
 
 func (hs *atlasServer) vagrantAppExistingHandler(w http.ResponseWriter, r *http.Request) {
@@ -356,6 +1132,11 @@ func (hs *atlasServer) vagrantBCCreateHandler(w http.ResponseWriter, r *http.Req
 }
 
 func (hs *atlasServer) vagrantBCCreateVersionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		hs.vagrantBCVersionsHandler(w, r)
+		return
+	}
+
 	if r.Method != "POST" {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
@@ -383,11 +1164,71 @@ func (hs *atlasServer) vagrantBCCreateVersionHandler(w http.ResponseWriter, r *h
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, `
 	{
-		"upload_path": "%s"
+		"upload_path": "%s",
+		"version": 3
 	}
 	`, uploadPath)
 }
 
+// vagrantBCVersionsHandler lists versions 1 and 2 of hashicorp/existing.
+// Version 2 has a sensitive var whose value isn't masked by the server.
+func (hs *atlasServer) vagrantBCVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, `
+	{
+		"versions": [
+			{
+				"version": 1,
+				"builds": [{"name": "foo", "type": "amazon-ebs", "artifact": true}]
+			},
+			{
+				"version": 2,
+				"metadata": {"testing": true},
+				"builds": [{"name": "foo", "type": "amazon-ebs", "artifact": true}],
+				"packer_vars": [
+					{"key": "region", "value": "us-east-1"},
+					{"key": "secret", "value": "hunter2", "sensitive": true}
+				]
+			}
+		]
+	}
+	`)
+}
+
+// vagrantBCVersionHandler serves versions 1 and 2 of hashicorp/existing and
+// their templates, which redirect to the storage.
+func (hs *atlasServer) vagrantBCVersionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var version int
+	var file string
+	fmt.Sscanf(strings.TrimPrefix(r.URL.Path,
+		"/api/v1/packer/build-configurations/hashicorp/existing/versions/"), "%d/%s", &version, &file)
+	if version != 1 && version != 2 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch file {
+	case "template":
+		http.Redirect(w, r, hs.URL.String()+"/_storage/template", http.StatusFound)
+	case "":
+		fmt.Fprintf(w, `
+		{
+			"version": {
+				"version": %d,
+				"builds": [{"name": "foo", "type": "amazon-ebs", "artifact": true}],
+				"packer_vars": [{"key": "secret", "value": "hunter2", "sensitive": true}]
+			}
+		}
+		`, version)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
 func (hs *atlasServer) vagrantBCExistingHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -455,6 +1296,11 @@ func (hs *atlasServer) vagrantCreateAppsHandler(w http.ResponseWriter, r *http.R
 }
 
 func (hs *atlasServer) vagrantUploadAppHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		hs.vagrantAppVersionsHandler(w, r)
+		return
+	}
+
 	u := *hs.URL
 	u.Path = path.Join(u.Path, "_binstore/630e42d9-2364-2412-4121-18266770468e")
 
@@ -467,7 +1313,7 @@ func (hs *atlasServer) vagrantUploadAppHandler(w http.ResponseWriter, r *http.Re
 		hs.t.Fatalf("expected metadata to be %q, but was %q", expected, buf.String())
 	}
 
-	body, err := json.Marshal(&appVersion{
+	body, err := json.Marshal(&AppVersion{
 		UploadPath: u.String(),
 		Token:      "630e42d9-2364-2412-4121-18266770468e",
 		Version:    125,
@@ -480,11 +1326,193 @@ func (hs *atlasServer) vagrantUploadAppHandler(w http.ResponseWriter, r *http.Re
 	fmt.Fprintf(w, string(body))
 }
 
+// vagrantUploadAppChunkedHandler creates version 1 of hashicorp/chunked,
+// uploaded to storage that accepts chunks.
+func (hs *atlasServer) vagrantUploadAppChunkedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	json.NewEncoder(w).Encode(&AppVersion{
+		UploadPath: hs.URL.String() + "/_binstore-chunked/ok",
+		Version:    1,
+	})
+}
+
+// vagrantAppVersionsHandler lists versions 1 and 2 of hashicorp/existing.
+func (hs *atlasServer) vagrantAppVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(&appVersionsWrapper{Versions: []*AppVersion{
+		{Version: 1, Metadata: map[string]interface{}{"testing": true}},
+		{Version: 2},
+	}})
+}
+
+// vagrantAppVersionHandler serves versions 1 and 2 of hashicorp/existing
+// and their slugs, which redirect to the storage.
+func (hs *atlasServer) vagrantAppVersionHandler(w http.ResponseWriter, r *http.Request) {
+	var version uint64
+	var slug string
+	fmt.Sscanf(strings.TrimPrefix(r.URL.Path,
+		"/api/v1/vagrant/applications/hashicorp/existing/versions/"), "%d/%s", &version, &slug)
+	if version != 1 && version != 2 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case r.Method == "GET" && slug == "slug":
+		http.Redirect(w, r, hs.URL.String()+"/_storage/box", http.StatusFound)
+	case r.Method == "GET" && slug == "":
+		json.NewEncoder(w).Encode(&appVersionWrapper{&AppVersion{Version: version}})
+	case r.Method == "DELETE" && slug == "":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// testBuildLog is the log of the "foo" builder of build 2.
+const testBuildLog = "line 1\nline 2\nline 3\n"
+
+// buildsHandler lists builds 1 and 2 of hashicorp/existing, and queues build
+// 3 of version 2.
+func (hs *atlasServer) buildsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		fmt.Fprintf(w, `
+		{
+			"builds": [
+				{"id": 1, "version": 1, "status": "finished"},
+				{"id": 2, "version": 2, "status": "running"}
+			]
+		}
+		`)
+	case "POST":
+		var wrapper struct {
+			Build struct {
+				Version int    `json:"version"`
+				Message string `json:"message"`
+			} `json:"build"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&wrapper); err != nil {
+			hs.t.Fatal(err)
+		}
+
+		if wrapper.Build.Version != 2 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		fmt.Fprintf(w, `
+		{
+			"build": {"id": 3, "version": 2, "status": "pending", "message": %q}
+		}
+		`, wrapper.Build.Message)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// buildHandler serves builds 1 and 2 of hashicorp/existing. Build 2 is
+// running for the first two requests, and finished after that. The log of
+// its "foo" builder is served one line per request.
+func (hs *atlasServer) buildHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var id int
+	var rest string
+	fmt.Sscanf(strings.TrimPrefix(r.URL.Path,
+		"/api/v1/packer/build-configurations/hashicorp/existing/builds/"), "%d/%s", &id, &rest)
+
+	switch {
+	case id == 1 && rest == "":
+		fmt.Fprintf(w, `
+		{
+			"build": {
+				"id": 1,
+				"version": 1,
+				"status": "finished",
+				"builders": [{"name": "foo", "type": "amazon-ebs", "status": "finished"}]
+			}
+		}
+		`)
+	case id == 2 && rest == "":
+		status := "running"
+		if hs.attempt(r.URL.Path) > 2 {
+			status = "finished"
+		}
+
+		fmt.Fprintf(w, `
+		{
+			"build": {
+				"id": 2,
+				"version": 2,
+				"status": %q,
+				"builders": [{"name": "foo", "type": "amazon-ebs", "status": %q}]
+			}
+		}
+		`, status, status)
+	case id == 2 && rest == "builders/foo/log":
+		offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+		if err != nil || offset > len(testBuildLog) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		log := testBuildLog[offset:]
+		if i := strings.Index(log, "\n"); i >= 0 {
+			log = log[:i+1]
+		}
+		io.WriteString(w, log)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// binstoreHandler accepts uploads, recording them and returning their
+// checksums like a storage backend. Like S3, it needs a Content-Length. It
+// verifies the Content-MD5 header if there is one, and requires it for
+// uploads to /_binstore/md5. Uploads to /_binstore/corrupt get a wrong
+// checksum back.
 func (hs *atlasServer) binstoreHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "PUT" {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
+	if r.ContentLength < 0 {
+		w.WriteHeader(http.StatusLengthRequired)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+
+	md5sum := md5.Sum(body)
+	v := r.Header.Get("Content-MD5")
+	if v != base64.StdEncoding.EncodeToString(md5sum[:]) {
+		if v != "" || strings.HasSuffix(r.URL.Path, "/md5") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	hs.attemptsLock.Lock()
+	hs.uploads = append(hs.uploads, string(body))
+	hs.attemptsLock.Unlock()
+
+	if strings.HasSuffix(r.URL.Path, "/corrupt") {
+		body = append(body, '!')
+	}
+
+	sum := sha256.Sum256(body)
+	w.Header().Set(StorageChecksumHeader, hex.EncodeToString(sum[:]))
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5sum))
 	w.WriteHeader(http.StatusOK)
 }
@@ -1,8 +1,8 @@
 package atlas
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"net/url"
 	"strings"
 )
@@ -17,7 +17,12 @@ import (
 // If authentication is successful, this method sets the Token value on the
 // Client and returns the Token as a string.
 func (c *Client) Login(username, password string) (string, error) {
-	log.Printf("[INFO] logging in user %s", username)
+	return c.LoginContext(context.Background(), username, password)
+}
+
+// LoginContext is like Login, but uses the given context for the request.
+func (c *Client) LoginContext(ctx context.Context, username, password string) (string, error) {
+	c.logger().Infof("logging in user %s", username)
 
 	if len(username) == 0 {
 		return "", fmt.Errorf("client: missing username")
@@ -28,7 +33,7 @@ func (c *Client) Login(username, password string) (string, error) {
 	}
 
 	// Make a request
-	request, err := c.Request("POST", "/api/v1/authenticate", &RequestOptions{
+	request, err := c.RequestContext(ctx, "POST", "/api/v1/authenticate", &RequestOptions{
 		Body: strings.NewReader(url.Values{
 			"user[login]":       []string{username},
 			"user[password]":    []string{password},
@@ -43,7 +48,7 @@ func (c *Client) Login(username, password string) (string, error) {
 	}
 
 	// Make the request
-	response, err := checkResp(c.HTTPClient.Do(request))
+	response, err := c.do(request)
 	if err != nil {
 		return "", err
 	}
@@ -55,7 +60,7 @@ func (c *Client) Login(username, password string) (string, error) {
 	}
 
 	// Set the token
-	log.Printf("[DEBUG] setting atlas token (%s)", maskString(tResponse.Token))
+	c.logger().Debugf("setting atlas token (%s)", maskString(tResponse.Token))
 	c.Token = tResponse.Token
 
 	// Return the token
@@ -65,15 +70,25 @@ func (c *Client) Login(username, password string) (string, error) {
 // Verify verifies that authentication and communication with Atlas
 // is properly functioning.
 func (c *Client) Verify() error {
-	log.Printf("[INFO] verifying authentication")
+	return c.VerifyContext(context.Background())
+}
+
+// VerifyContext is like Verify, but uses the given context for the request.
+func (c *Client) VerifyContext(ctx context.Context) error {
+	c.logger().Infof("verifying authentication")
+
+	request, err := c.RequestContext(ctx, "GET", "/api/v1/authenticate", nil)
+	if err != nil {
+		return err
+	}
 
-	request, err := c.Request("GET", "/api/v1/authenticate", nil)
+	response, err := c.do(request)
 	if err != nil {
 		return err
 	}
+	discardResp(response)
 
-	_, err = checkResp(c.HTTPClient.Do(request))
-	return err
+	return nil
 }
 
 // maskString masks all but the first few characters of a string for display
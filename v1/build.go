@@ -0,0 +1,310 @@
+package atlas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// BuildStatus is the status of a Build, or of a single builder in it.
+type BuildStatus string
+
+// The statuses of builds and builders.
+const (
+	BuildPending  BuildStatus = "pending"
+	BuildRunning  BuildStatus = "running"
+	BuildFinished BuildStatus = "finished"
+	BuildErrored  BuildStatus = "errored"
+	BuildCanceled BuildStatus = "canceled"
+)
+
+// Done reports whether the status is final, that is the build (or builder)
+// finished, errored or was canceled.
+func (s BuildStatus) Done() bool {
+	switch s {
+	case BuildFinished, BuildErrored, BuildCanceled:
+		return true
+	default:
+		return false
+	}
+}
+
+// Build is a single run of a version of a Packer build configuration.
+type Build struct {
+	// ID is the number of the build, unique in the scope of the build
+	// configuration.
+	ID int `json:"id"`
+
+	// User and Name identify the build configuration, and Version is the
+	// version of it that is built.
+	User    string `json:"username"`
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+
+	// Status is the status of the build as a whole.
+	Status BuildStatus `json:"status"`
+
+	// Message is the message the build was queued with, if any.
+	Message string `json:"message,omitempty"`
+
+	// Builders are the builds of the configuration that run as part of
+	// this build, with their own status.
+	Builders []*BuildBuilder `json:"builders,omitempty"`
+
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// Slug returns the slug format of the build configuration (User/Name).
+func (b *Build) Slug() string {
+	return fmt.Sprintf("%s/%s", b.User, b.Name)
+}
+
+// Builder returns the builder with the given name, or nil if there is none.
+func (b *Build) Builder(name string) *BuildBuilder {
+	for _, bb := range b.Builders {
+		if bb.Name == name {
+			return bb
+		}
+	}
+
+	return nil
+}
+
+// BuildBuilder is the status of a single builder of a Build. It matches one
+// of the BuildConfigBuilds of the version that is built.
+type BuildBuilder struct {
+	Name   string      `json:"name"`
+	Type   string      `json:"type"`
+	Status BuildStatus `json:"status"`
+}
+
+// buildWrapper is the API wrapper around a single Build.
+type buildWrapper struct {
+	Build *Build `json:"build"`
+}
+
+// buildsWrapper is the API wrapper around a list of Builds.
+type buildsWrapper struct {
+	Builds []*Build `json:"builds"`
+}
+
+// QueueBuild queues a build of the given version of a build configuration.
+// If v.Version is zero, the latest version is built. The message is shown
+// with the build and may be empty.
+func (c *Client) QueueBuild(v *BuildConfigVersion, message string) (*Build, error) {
+	return c.QueueBuildContext(context.Background(), v, message)
+}
+
+// QueueBuildContext is like QueueBuild, but uses the given context for the
+// request.
+func (c *Client) QueueBuildContext(ctx context.Context, v *BuildConfigVersion, message string) (*Build, error) {
+	c.logger().Infof("queueing build of %s version %d", v.Slug(), v.Version)
+
+	endpoint := fmt.Sprintf("/api/v1/packer/build-configurations/%s/%s/builds",
+		v.User, v.Name)
+
+	var bodyData struct {
+		Build struct {
+			Version int    `json:"version,omitempty"`
+			Message string `json:"message,omitempty"`
+		} `json:"build"`
+	}
+	bodyData.Build.Version = v.Version
+	bodyData.Build.Message = message
+	body, err := json.Marshal(bodyData)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := c.RequestContext(ctx, "POST", endpoint, &RequestOptions{
+		Body: bytes.NewReader(body),
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeBuild(response, v.User, v.Name)
+}
+
+// Builds returns every build of the build configuration, with its status.
+// Use BuildsIter to fetch the pages of builds as they are needed.
+func (c *Client) Builds(user, name string) ([]*Build, error) {
+	return c.BuildsContext(context.Background(), user, name)
+}
+
+// BuildsContext is like Builds, but uses the given context for the
+// requests.
+func (c *Client) BuildsContext(ctx context.Context, user, name string) ([]*Build, error) {
+	builds, err := c.BuildsIterContext(ctx, user, name, nil).All()
+	if err != nil {
+		return nil, err
+	}
+
+	return builds, nil
+}
+
+// BuildsIter returns an iterator over the builds of the build
+// configuration. A nil opts is the same as an empty one.
+func (c *Client) BuildsIter(user, name string, opts *ListOptions) *BuildIterator {
+	return c.BuildsIterContext(context.Background(), user, name, opts)
+}
+
+// BuildsIterContext is like BuildsIter, but uses the given context for the
+// requests.
+func (c *Client) BuildsIterContext(ctx context.Context, user, name string, opts *ListOptions) *BuildIterator {
+	c.logger().Infof("listing builds of build configuration %s/%s", user, name)
+
+	if opts == nil {
+		opts = new(ListOptions)
+	}
+
+	endpoint := fmt.Sprintf("/api/v1/packer/build-configurations/%s/%s/builds",
+		user, name)
+
+	it := &BuildIterator{new(iterator)}
+	it.pager = newPager(ctx, c, endpoint, nil, *opts,
+		func(response *http.Response) ([]interface{}, error) {
+			var w buildsWrapper
+			if err := decodeJSON(response, &w); err != nil {
+				return nil, err
+			}
+
+			items := make([]interface{}, len(w.Builds))
+			for i, b := range w.Builds {
+				b.fill(user, name)
+				items[i] = b
+			}
+			return items, nil
+		})
+
+	return it
+}
+
+// Build gets a single build of the build configuration. If the build
+// doesn't exist, an error matching ErrNotFound (see errors.Is) is returned.
+func (c *Client) Build(user, name string, id int) (*Build, error) {
+	return c.BuildContext(context.Background(), user, name, id)
+}
+
+// BuildContext is like Build, but uses the given context for the request.
+func (c *Client) BuildContext(ctx context.Context, user, name string, id int) (*Build, error) {
+	c.logger().Infof("getting build %d of %s/%s", id, user, name)
+
+	endpoint := fmt.Sprintf("/api/v1/packer/build-configurations/%s/%s/builds/%d",
+		user, name, id)
+	request, err := c.RequestContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeBuild(response, user, name)
+}
+
+// WaitForBuild polls the build until it is done, and returns it in its
+// final state. A build that errored or was canceled isn't an error; check
+// its Status. A nil opts is the same as an empty one.
+func (c *Client) WaitForBuild(user, name string, id int, opts *PollOptions) (*Build, error) {
+	return c.WaitForBuildContext(context.Background(), user, name, id, opts)
+}
+
+// WaitForBuildContext is like WaitForBuild, but uses the given context for
+// the requests.
+func (c *Client) WaitForBuildContext(ctx context.Context, user, name string, id int,
+	opts *PollOptions) (*Build, error) {
+	c.logger().Infof("waiting for build %d of %s/%s", id, user, name)
+
+	var build *Build
+	err := poll(ctx, opts, func(ctx context.Context) (bool, error) {
+		var err error
+		build, err = c.BuildContext(ctx, user, name, id)
+		if err != nil {
+			return false, err
+		}
+
+		c.logger().Debugf("build %d of %s/%s is %s", id, user, name, build.Status)
+		return build.Status.Done(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return build, nil
+}
+
+// BuildLog returns the log of the given builder of a build. The log is read
+// as it is written: reads block, polling the server, until there is more
+// output, and io.EOF is only returned once the builder is done and all of
+// its output was read. The returned reader must be closed.
+//
+// If the builder isn't part of the build, the log is followed until the
+// build as a whole is done. A nil opts is the same as an empty one.
+func (c *Client) BuildLog(user, name string, id int, builder string, opts *PollOptions) io.ReadCloser {
+	return c.BuildLogContext(context.Background(), user, name, id, builder, opts)
+}
+
+// BuildLogContext is like BuildLog, but uses the given context for the
+// requests.
+func (c *Client) BuildLogContext(ctx context.Context, user, name string, id int,
+	builder string, opts *PollOptions) io.ReadCloser {
+	c.logger().Infof("following log of builder %s of build %d of %s/%s", builder, id, user, name)
+
+	endpoint := fmt.Sprintf("/api/v1/packer/build-configurations/%s/%s/builds/%d/builders/%s/log",
+		user, name, id, builder)
+	return c.followLog(ctx, endpoint, opts, func(ctx context.Context) (bool, error) {
+		build, err := c.BuildContext(ctx, user, name, id)
+		if err != nil {
+			return false, err
+		}
+
+		status := build.Status
+		if bb := build.Builder(builder); bb != nil {
+			status = bb.Status
+		}
+
+		return status.Done(), nil
+	})
+}
+
+// decodeBuild decodes a single wrapped Build from the response.
+func decodeBuild(response *http.Response, user, name string) (*Build, error) {
+	var w buildWrapper
+	if err := decodeJSON(response, &w); err != nil {
+		return nil, err
+	}
+
+	if w.Build == nil {
+		return nil, fmt.Errorf("client: missing build in response")
+	}
+
+	w.Build.fill(user, name)
+	return w.Build, nil
+}
+
+// fill fills in the user and name of a build returned by the server, which
+// doesn't repeat them.
+func (b *Build) fill(user, name string) {
+	if b.User == "" {
+		b.User = user
+	}
+	if b.Name == "" {
+		b.Name = name
+	}
+}
@@ -2,12 +2,18 @@ package atlas
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"net/http"
+	"time"
 )
 
+// MaskedValue replaces the value of sensitive BuildVars returned by the
+// API, so that they can't leak through the client.
+const MaskedValue = "*** (masked)"
+
 // bcWrapper is the API wrapper since the server wraps the resulting object.
 type bcWrapper struct {
 	BuildConfig *BuildConfig `json:"build_configuration"`
@@ -21,6 +27,24 @@ type BuildVar struct {
 }
 type BuildVars []BuildVar
 
+// masked returns a copy of the vars with the value of every sensitive var
+// replaced by MaskedValue.
+func (vars BuildVars) masked() BuildVars {
+	if vars == nil {
+		return nil
+	}
+
+	result := make(BuildVars, len(vars))
+	for i, v := range vars {
+		if v.Sensitive {
+			v.Value = MaskedValue
+		}
+		result[i] = v
+	}
+
+	return result
+}
+
 // BuildConfig represents a Packer build configuration.
 type BuildConfig struct {
 	// User is the namespace under which the build config lives
@@ -45,7 +69,20 @@ type BuildConfigVersion struct {
 	Name string `json:"name"`
 
 	// Builds is the list of builds that this version supports.
-	Builds []BuildConfigBuild
+	Builds []BuildConfigBuild `json:"builds"`
+
+	// Version is the version number. It is set by the server, and filled
+	// in by UploadBuildConfigVersion once the version is created.
+	Version int `json:"version,omitempty"`
+
+	// Metadata and Vars are what the version was uploaded with. They are
+	// only set on versions returned by the server; the values of sensitive
+	// Vars are always MaskedValue.
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Vars     BuildVars              `json:"packer_vars,omitempty"`
+
+	// CreatedAt is when the version was created, if the server says.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
 }
 
 // Slug returns the slug format for this BuildConfigVersion (User/Name)
@@ -70,15 +107,21 @@ type BuildConfigBuild struct {
 
 // BuildConfig gets a single build configuration by user and name.
 func (c *Client) BuildConfig(user, name string) (*BuildConfig, error) {
-	log.Printf("[INFO] getting build configuration %s/%s", user, name)
+	return c.BuildConfigContext(context.Background(), user, name)
+}
+
+// BuildConfigContext is like BuildConfig, but uses the given context for the
+// request.
+func (c *Client) BuildConfigContext(ctx context.Context, user, name string) (*BuildConfig, error) {
+	c.logger().Infof("getting build configuration %s/%s", user, name)
 
 	endpoint := fmt.Sprintf("/api/v1/packer/build-configurations/%s/%s", user, name)
-	request, err := c.Request("GET", endpoint, nil)
+	request, err := c.RequestContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	response, err := checkResp(c.HTTPClient.Do(request))
+	response, err := c.do(request)
 	if err != nil {
 		return nil, err
 	}
@@ -93,7 +136,13 @@ func (c *Client) BuildConfig(user, name string) (*BuildConfig, error) {
 
 // CreateBuildConfig creates a new build configuration.
 func (c *Client) CreateBuildConfig(user, name string) (*BuildConfig, error) {
-	log.Printf("[INFO] creating build configuration %s/%s", user, name)
+	return c.CreateBuildConfigContext(context.Background(), user, name)
+}
+
+// CreateBuildConfigContext is like CreateBuildConfig, but uses the given
+// context for the request.
+func (c *Client) CreateBuildConfigContext(ctx context.Context, user, name string) (*BuildConfig, error) {
+	c.logger().Infof("creating build configuration %s/%s", user, name)
 
 	endpoint := "/api/v1/packer/build-configurations"
 	body, err := json.Marshal(&bcWrapper{
@@ -106,7 +155,7 @@ func (c *Client) CreateBuildConfig(user, name string) (*BuildConfig, error) {
 		return nil, err
 	}
 
-	request, err := c.Request("POST", endpoint, &RequestOptions{
+	request, err := c.RequestContext(ctx, "POST", endpoint, &RequestOptions{
 		Body: bytes.NewReader(body),
 		Headers: map[string]string{
 			"Content-Type": "application/json",
@@ -116,7 +165,7 @@ func (c *Client) CreateBuildConfig(user, name string) (*BuildConfig, error) {
 		return nil, err
 	}
 
-	response, err := checkResp(c.HTTPClient.Do(request))
+	response, err := c.do(request)
 	if err != nil {
 		return nil, err
 	}
@@ -130,18 +179,35 @@ func (c *Client) CreateBuildConfig(user, name string) (*BuildConfig, error) {
 }
 
 // UploadBuildConfigVersion creates a single build configuration version
-// and uploads the template associated with it.
+// and uploads the template associated with it. On success, the number of
+// the new version is stored in v.Version.
 //
 // Actual API: "Create Build Config Version"
 func (c *Client) UploadBuildConfigVersion(v *BuildConfigVersion, metadata map[string]interface{},
 	vars BuildVars, data io.Reader, size int64) error {
+	return c.UploadBuildConfigVersionContext(context.Background(), v, metadata, vars, data, size, nil)
+}
 
-	log.Printf("[INFO] uploading build configuration version %s (%d bytes), with metadata %q",
+// UploadBuildConfigVersionContext is like UploadBuildConfigVersion, but uses
+// the given context for the requests, including the file upload. The upload
+// options, if not nil, are used for the file upload instead of the client's
+// UploadOptions.
+func (c *Client) UploadBuildConfigVersionContext(ctx context.Context, v *BuildConfigVersion, metadata map[string]interface{},
+	vars BuildVars, data io.Reader, size int64, opts *UploadOptions) error {
+
+	c.logger().Infof("uploading build configuration version %s (%d bytes), with metadata %q",
 		v.Slug(), size, metadata)
 
 	endpoint := fmt.Sprintf("/api/v1/packer/build-configurations/%s/%s/versions",
 		v.User, v.Name)
 
+	// Make sure sensitive values never show up in the logs
+	for _, bv := range vars {
+		if bv.Sensitive {
+			c.addSecret(bv.Value)
+		}
+	}
+
 	var bodyData bcCreateWrapper
 	bodyData.Version.Builds = v.Builds
 	bodyData.Version.Metadata = metadata
@@ -151,7 +217,7 @@ func (c *Client) UploadBuildConfigVersion(v *BuildConfigVersion, metadata map[st
 		return err
 	}
 
-	request, err := c.Request("POST", endpoint, &RequestOptions{
+	request, err := c.RequestContext(ctx, "POST", endpoint, &RequestOptions{
 		Body: bytes.NewReader(body),
 		Headers: map[string]string{
 			"Content-Type": "application/json",
@@ -161,7 +227,7 @@ func (c *Client) UploadBuildConfigVersion(v *BuildConfigVersion, metadata map[st
 		return err
 	}
 
-	response, err := checkResp(c.HTTPClient.Do(request))
+	response, err := c.do(request)
 	if err != nil {
 		return err
 	}
@@ -171,16 +237,163 @@ func (c *Client) UploadBuildConfigVersion(v *BuildConfigVersion, metadata map[st
 		return err
 	}
 
-	if err := c.putFile(bv.UploadPath, data, size); err != nil {
+	if err := c.putFile(ctx, bv.UploadPath, data, size, opts); err != nil {
 		return err
 	}
 
+	v.Version = bv.Version
 	return nil
 }
 
+// BuildConfigVersions returns every version of the build configuration,
+// with its builds, metadata and vars. Use BuildConfigVersionsIter to fetch
+// the pages of versions as they are needed.
+func (c *Client) BuildConfigVersions(user, name string) ([]*BuildConfigVersion, error) {
+	return c.BuildConfigVersionsContext(context.Background(), user, name)
+}
+
+// BuildConfigVersionsContext is like BuildConfigVersions, but uses the given
+// context for the requests.
+func (c *Client) BuildConfigVersionsContext(ctx context.Context, user, name string) ([]*BuildConfigVersion, error) {
+	versions, err := c.BuildConfigVersionsIterContext(ctx, user, name, nil).All()
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// BuildConfigVersionsIter returns an iterator over the versions of the
+// build configuration. A nil opts is the same as an empty one.
+func (c *Client) BuildConfigVersionsIter(user, name string, opts *ListOptions) *BuildConfigVersionIterator {
+	return c.BuildConfigVersionsIterContext(context.Background(), user, name, opts)
+}
+
+// BuildConfigVersionsIterContext is like BuildConfigVersionsIter, but uses
+// the given context for the requests.
+func (c *Client) BuildConfigVersionsIterContext(ctx context.Context, user, name string,
+	opts *ListOptions) *BuildConfigVersionIterator {
+	c.logger().Infof("listing versions of build configuration %s/%s", user, name)
+
+	if opts == nil {
+		opts = new(ListOptions)
+	}
+
+	endpoint := fmt.Sprintf("/api/v1/packer/build-configurations/%s/%s/versions",
+		user, name)
+
+	it := &BuildConfigVersionIterator{new(iterator)}
+	it.pager = newPager(ctx, c, endpoint, nil, *opts,
+		func(response *http.Response) ([]interface{}, error) {
+			var w bcVersionsWrapper
+			if err := decodeJSON(response, &w); err != nil {
+				return nil, err
+			}
+
+			items := make([]interface{}, len(w.Versions))
+			for i, bv := range w.Versions {
+				c.fillBuildConfigVersion(bv, user, name)
+				items[i] = bv
+			}
+			return items, nil
+		})
+
+	return it
+}
+
+// BuildConfigVersion gets the given version of the build configuration. If
+// the version doesn't exist, an error matching ErrNotFound (see errors.Is)
+// is returned.
+func (c *Client) BuildConfigVersion(user, name string, version int) (*BuildConfigVersion, error) {
+	return c.BuildConfigVersionContext(context.Background(), user, name, version)
+}
+
+// BuildConfigVersionContext is like BuildConfigVersion, but uses the given
+// context for the request.
+func (c *Client) BuildConfigVersionContext(ctx context.Context, user, name string,
+	version int) (*BuildConfigVersion, error) {
+	c.logger().Infof("getting build configuration %s/%s version %d", user, name, version)
+
+	endpoint := fmt.Sprintf("/api/v1/packer/build-configurations/%s/%s/versions/%d",
+		user, name, version)
+	request, err := c.RequestContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var w bcVersionWrapper
+	if err := decodeJSON(response, &w); err != nil {
+		return nil, err
+	}
+
+	if w.Version == nil {
+		return nil, fmt.Errorf("client: missing version in response")
+	}
+
+	c.fillBuildConfigVersion(w.Version, user, name)
+	return w.Version, nil
+}
+
+// DownloadBuildConfigVersion downloads the Packer template archive that was
+// uploaded with the given version of the build configuration into w,
+// returning the number of bytes written. Like DownloadArtifact, the token
+// isn't sent to the storage backend, and interrupted downloads are resumed.
+func (c *Client) DownloadBuildConfigVersion(user, name string, version int,
+	w io.WriterAt, opts *DownloadArtifactOpts) (int64, error) {
+	return c.DownloadBuildConfigVersionContext(context.Background(), user, name, version, w, opts)
+}
+
+// DownloadBuildConfigVersionContext is like DownloadBuildConfigVersion, but
+// uses the given context for the requests.
+func (c *Client) DownloadBuildConfigVersionContext(ctx context.Context, user, name string, version int,
+	w io.WriterAt, opts *DownloadArtifactOpts) (int64, error) {
+	c.logger().Infof("downloading build configuration %s/%s version %d", user, name, version)
+
+	endpoint := fmt.Sprintf("/api/v1/packer/build-configurations/%s/%s/versions/%d/template",
+		user, name, version)
+	return c.fetchFile(ctx, endpoint, w, 0, nil, opts)
+}
+
+// fillBuildConfigVersion fills in the user and name of a version returned
+// by the server, which doesn't repeat them, and masks its sensitive vars.
+func (c *Client) fillBuildConfigVersion(bv *BuildConfigVersion, user, name string) {
+	if bv.User == "" {
+		bv.User = user
+	}
+	if bv.Name == "" {
+		bv.Name = name
+	}
+
+	// The server should never return sensitive values, but if it does make
+	// sure they don't go any further. The debug log of the response masks
+	// them already.
+	for _, v := range bv.Vars {
+		if v.Sensitive && v.Value != MaskedValue {
+			c.addSecret(v.Value)
+		}
+	}
+	bv.Vars = bv.Vars.masked()
+}
+
 // bcCreate is the struct returned when creating a build configuration.
 type bcCreate struct {
 	UploadPath string `json:"upload_path"`
+	Version    int    `json:"version"`
+}
+
+// bcVersionWrapper is the API wrapper around a single BuildConfigVersion.
+type bcVersionWrapper struct {
+	Version *BuildConfigVersion `json:"version"`
+}
+
+// bcVersionsWrapper is the API wrapper around a list of BuildConfigVersions.
+type bcVersionsWrapper struct {
+	Versions []*BuildConfigVersion `json:"versions"`
 }
 
 // bcCreateWrapper is the wrapper for creating a build config.
@@ -2,7 +2,10 @@ package atlas
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -93,4 +96,164 @@ func TestUploadBuildConfigVersion(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+
+	if bc.Version != 3 {
+		t.Fatalf("expected %d to be %d", bc.Version, 3)
+	}
+}
+
+func TestUploadBuildConfigVersionContext_uploadOptions(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress := new(testProgress)
+	bc := &BuildConfigVersion{
+		User:   "hashicorp",
+		Name:   "existing",
+		Builds: []BuildConfigBuild{{Name: "foo", Type: "ami"}},
+	}
+	metadata := map[string]interface{}{"testing": true}
+	data := bytes.NewReader([]byte("hello"))
+	err = client.UploadBuildConfigVersionContext(context.Background(), bc, metadata, nil,
+		data, data.Size(), &UploadOptions{Progress: progress.report})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := progress.last()
+	if last.Bytes != 5 || last.Total != 5 {
+		t.Fatalf("bad: %#v", last)
+	}
+}
+
+func TestBuildConfigVersions(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := client.BuildConfigVersions("hashicorp", "existing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(versions) != 2 {
+		t.Fatalf("bad: %#v", versions)
+	}
+
+	bv := versions[1]
+	if bv.Slug() != "hashicorp/existing" || bv.Version != 2 {
+		t.Fatalf("bad: %#v", bv)
+	}
+
+	expected := map[string]interface{}{"testing": true}
+	if !reflect.DeepEqual(bv.Metadata, expected) {
+		t.Fatalf("expected %#v to be %#v", bv.Metadata, expected)
+	}
+
+	expectedBuilds := []BuildConfigBuild{{Name: "foo", Type: "amazon-ebs", Artifact: true}}
+	if !reflect.DeepEqual(bv.Builds, expectedBuilds) {
+		t.Fatalf("expected %#v to be %#v", bv.Builds, expectedBuilds)
+	}
+
+	expectedVars := BuildVars{
+		{Key: "region", Value: "us-east-1"},
+		{Key: "secret", Value: MaskedValue, Sensitive: true},
+	}
+	if !reflect.DeepEqual(bv.Vars, expectedVars) {
+		t.Fatalf("expected %#v to be %#v", bv.Vars, expectedVars)
+	}
+}
+
+func TestBuildConfigVersions_logging(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := new(testLogger)
+	client.Logger = l
+
+	if _, err := client.BuildConfigVersions("hashicorp", "existing"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server returns the value of the sensitive var, which must not
+	// reach the debug log of the response
+	output := l.String()
+	if !strings.Contains(output, "[DEBUG] response:") {
+		t.Fatalf("expected the response to be logged:\n%s", output)
+	}
+	if strings.Contains(output, "hunter2") {
+		t.Fatalf("sensitive value was logged:\n%s", output)
+	}
+}
+
+func TestBuildConfigVersion(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bv, err := client.BuildConfigVersion("hashicorp", "existing", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bv.Slug() != "hashicorp/existing" || bv.Version != 1 {
+		t.Fatalf("bad: %#v", bv)
+	}
+
+	if len(bv.Vars) != 1 || bv.Vars[0].Value != MaskedValue {
+		t.Fatalf("expected sensitive value to be masked: %#v", bv.Vars)
+	}
+}
+
+func TestBuildConfigVersion_notFound(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.BuildConfigVersion("hashicorp", "existing", 5)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v to be ErrNotFound", err)
+	}
+}
+
+func TestDownloadBuildConfigVersion(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := new(memWriterAt)
+	n, err := client.DownloadBuildConfigVersion("hashicorp", "existing", 2, w, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != int64(len(testArtifactFile)) || !bytes.Equal(w.buf, testArtifactFile) {
+		t.Fatalf("bad: %d bytes", n)
+	}
 }
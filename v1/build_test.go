@@ -0,0 +1,212 @@
+package atlas
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestBuildStatus_Done(t *testing.T) {
+	cases := map[BuildStatus]bool{
+		BuildPending:  false,
+		BuildRunning:  false,
+		BuildFinished: true,
+		BuildErrored:  true,
+		BuildCanceled: true,
+	}
+
+	for status, expected := range cases {
+		if status.Done() != expected {
+			t.Errorf("expected %q done to be %t", status, expected)
+		}
+	}
+}
+
+func TestQueueBuild(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bv := &BuildConfigVersion{User: "hashicorp", Name: "existing", Version: 2}
+	build, err := client.QueueBuild(bv, "testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if build.ID != 3 || build.Slug() != "hashicorp/existing" || build.Version != 2 {
+		t.Fatalf("bad: %#v", build)
+	}
+
+	if build.Status != BuildPending {
+		t.Errorf("expected %q to be %q", build.Status, BuildPending)
+	}
+
+	if build.Message != "testing" {
+		t.Errorf("expected %q to be %q", build.Message, "testing")
+	}
+}
+
+func TestBuilds(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builds, err := client.Builds("hashicorp", "existing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(builds) != 2 {
+		t.Fatalf("bad: %#v", builds)
+	}
+
+	if builds[1].ID != 2 || builds[1].Status != BuildRunning || builds[1].Slug() != "hashicorp/existing" {
+		t.Fatalf("bad: %#v", builds[1])
+	}
+}
+
+func TestBuild(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build, err := client.Build("hashicorp", "existing", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if build.Status != BuildFinished {
+		t.Errorf("expected %q to be %q", build.Status, BuildFinished)
+	}
+
+	bb := build.Builder("foo")
+	if bb == nil || bb.Type != "amazon-ebs" || bb.Status != BuildFinished {
+		t.Fatalf("bad: %#v", bb)
+	}
+
+	if build.Builder("bar") != nil {
+		t.Fatal("expected no builder bar")
+	}
+}
+
+func TestBuild_notFound(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Build("hashicorp", "existing", 5)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v to be ErrNotFound", err)
+	}
+}
+
+func TestWaitForBuild(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	build, err := client.WaitForBuild("hashicorp", "existing", 2, &PollOptions{
+		Interval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if build.Status != BuildFinished {
+		t.Errorf("expected %q to be %q", build.Status, BuildFinished)
+	}
+
+	path := "/api/v1/packer/build-configurations/hashicorp/existing/builds/2"
+	if n := server.attemptCount(path); n != 3 {
+		t.Errorf("expected %d to be %d", n, 3)
+	}
+}
+
+func TestWaitForBuild_timeout(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.WaitForBuild("hashicorp", "existing", 2, &PollOptions{
+		Interval: time.Hour,
+		Timeout:  50 * time.Millisecond,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v to be context.DeadlineExceeded", err)
+	}
+}
+
+func TestBuildLog(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := client.BuildLog("hashicorp", "existing", 2, "foo", &PollOptions{
+		Interval: time.Millisecond,
+	})
+	defer log.Close()
+
+	data, err := ioutil.ReadAll(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != testBuildLog {
+		t.Fatalf("expected %q to be %q", data, testBuildLog)
+	}
+
+	// The log is only done once the build is
+	path := "/api/v1/packer/build-configurations/hashicorp/existing/builds/2"
+	if n := server.attemptCount(path); n != 3 {
+		t.Errorf("expected %d to be %d", n, 3)
+	}
+}
+
+func TestBuildLog_close(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := client.BuildLog("hashicorp", "existing", 2, "foo", nil)
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := log.Read(make([]byte, 10)); err == nil {
+		t.Fatal("expected error reading a closed log")
+	}
+}
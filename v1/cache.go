@@ -0,0 +1,252 @@
+package atlas
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CacheOptions configure a Cache.
+type CacheOptions struct {
+	// SearchTTL is how long artifact search results are used without asking
+	// the server. After that, they are revalidated with their ETag, so that
+	// unchanged results aren't downloaded again. Zero revalidates every
+	// time.
+	SearchTTL time.Duration
+
+	// MaxFileBytes is the total size of the cached artifact files. When it
+	// is exceeded, the least recently used files are removed. Zero means no
+	// limit.
+	MaxFileBytes int64
+}
+
+// Cache is an on-disk cache of artifact search results and artifact files.
+// Set Client.Cache to use it; clients don't cache anything by default.
+//
+// Files are stored by their checksum, so only downloads of versions with a
+// checksum in their metadata (see MetadataChecksumKey) are cached, and
+// every cached file is verified when it's used.
+//
+// Several processes can share a cache directory: entries are written to a
+// temporary file and renamed into place, so they are never seen half
+// written, and a file removed by another process is simply downloaded
+// again.
+type Cache struct {
+	dir  string
+	opts CacheOptions
+}
+
+// DefaultCacheDir returns the default location of the cache, in the user's
+// cache directory.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "atlas-go"), nil
+}
+
+// NewCache creates a Cache in the given directory, creating it if needed.
+// A nil opts is the same as an empty one.
+func NewCache(dir string, opts *CacheOptions) (*Cache, error) {
+	if opts == nil {
+		opts = new(CacheOptions)
+	}
+
+	c := &Cache{dir: dir, opts: *opts}
+	for _, d := range []string{c.searchDir(), c.filesDir()} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Cache) searchDir() string {
+	return filepath.Join(c.dir, "search")
+}
+
+func (c *Cache) filesDir() string {
+	return filepath.Join(c.dir, "files")
+}
+
+// cachedResponse is a response stored in the cache.
+type cachedResponse struct {
+	URL    string    `json:"url"`
+	ETag   string    `json:"etag"`
+	Link   []string  `json:"link,omitempty"`
+	Stored time.Time `json:"stored"`
+	Body   []byte    `json:"body"`
+}
+
+// response returns the cached response as an *http.Response.
+func (r *cachedResponse) response() *http.Response {
+	header := make(http.Header)
+	for _, link := range r.Link {
+		header.Add("Link", link)
+	}
+
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+	}
+}
+
+// searchKey returns the cache key of a request. The token is part of it,
+// so users sharing a cache don't see each other's results.
+func searchKey(token string, req *http.Request) string {
+	sum := sha256.Sum256([]byte(token + " " + req.URL.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookup returns the cached response with the given key, or nil.
+func (c *Cache) lookup(key string) *cachedResponse {
+	data, err := ioutil.ReadFile(filepath.Join(c.searchDir(), key+".json"))
+	if err != nil {
+		return nil
+	}
+
+	var r cachedResponse
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil
+	}
+
+	return &r
+}
+
+// fresh reports whether the cached response can be used without
+// revalidating it.
+func (c *Cache) fresh(r *cachedResponse) bool {
+	return time.Since(r.Stored) < c.opts.SearchTTL
+}
+
+// store saves a response in the cache under the given key.
+func (c *Cache) store(key string, r *cachedResponse) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return c.writeFile(filepath.Join(c.searchDir(), key+".json"), bytes.NewReader(data))
+}
+
+// writeFile atomically writes the data to the given path.
+func (c *Cache) writeFile(path string, r io.Reader) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// filePath returns where the file with the given checksum is cached.
+func (c *Cache) filePath(v *checksumVerifier) string {
+	return filepath.Join(c.filesDir(), v.typ+"-"+v.expected)
+}
+
+// openFile opens the cached file with the given checksum, marking it as
+// recently used. It returns nil if the file isn't cached.
+func (c *Cache) openFile(v *checksumVerifier) *os.File {
+	path := c.filePath(v)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	return f
+}
+
+// storeFile moves the downloaded file at tmp into the cache and opens it,
+// then evicts other files if the cache is too large. The file is opened
+// first, so it can still be read if another process evicts it.
+func (c *Cache) storeFile(v *checksumVerifier, tmp string) (*os.File, error) {
+	path := c.filePath(v)
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.evict(filepath.Base(path)); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// evict removes the least recently used files, other than the file named
+// keep, until the cached files fit in MaxFileBytes. The file named keep is
+// never removed, even if it doesn't fit by itself.
+func (c *Cache) evict(keep string) error {
+	if c.opts.MaxFileBytes <= 0 {
+		return nil
+	}
+
+	infos, err := ioutil.ReadDir(c.filesDir())
+	if err != nil {
+		return err
+	}
+
+	var files []os.FileInfo
+	var total int64
+	for _, fi := range infos {
+		// Skip downloads in progress
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		files = append(files, fi)
+		total += fi.Size()
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+
+	for _, fi := range files {
+		if total <= c.opts.MaxFileBytes {
+			break
+		}
+		if fi.Name() == keep {
+			continue
+		}
+
+		// Another process may have removed it already
+		err := os.Remove(filepath.Join(c.filesDir(), fi.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= fi.Size()
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package atlas
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testCache(t *testing.T, opts *CacheOptions) (*Cache, func()) {
+	dir, err := ioutil.TempDir("", "atlas-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := NewCache(dir, opts)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return cache, func() { os.RemoveAll(dir) }
+}
+
+func testCachedSearch(t *testing.T, client *Client) {
+	vs, err := client.ArtifactSearch(&ArtifactSearchOpts{
+		User: "hashicorp",
+		Name: "cached",
+		Type: "amazon-ami",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 1 || vs[0].Version != 1 {
+		t.Fatalf("bad: %#v", vs)
+	}
+}
+
+func TestCache_search(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	cache, cleanup := testCache(t, &CacheOptions{SearchTTL: time.Hour})
+	defer cleanup()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Cache = cache
+
+	testCachedSearch(t, client)
+	testCachedSearch(t, client)
+
+	path := "/api/v1/artifacts/hashicorp/cached/amazon-ami/search"
+	if n := server.attemptCount(path); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+}
+
+func TestCache_searchRevalidate(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	cache, cleanup := testCache(t, nil)
+	defer cleanup()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Cache = cache
+
+	testCachedSearch(t, client)
+	testCachedSearch(t, client)
+
+	path := "/api/v1/artifacts/hashicorp/cached/amazon-ami/search"
+	if n := server.attemptCount(path); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+	if n := server.attemptCount(path + "#304"); n != 1 {
+		t.Fatalf("expected 1 revalidation, got %d", n)
+	}
+}
+
+func TestCache_download(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	cache, cleanup := testCache(t, nil)
+	defer cleanup()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Token = "a.atlasv1.b"
+	client.Cache = cache
+
+	for i := 0; i < 2; i++ {
+		w := new(memWriterAt)
+		if _, err := client.DownloadArtifact(testDownloadVersion(1), w, nil); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(w.buf, testArtifactFile) {
+			t.Fatalf("download %d: bad content", i)
+		}
+	}
+
+	path := "/api/v1/artifacts/hashicorp/existing/vagrant-box/1/file"
+	if n := server.attemptCount(path); n != 1 {
+		t.Fatalf("expected 1 request, got %d", n)
+	}
+}
+
+func TestCache_downloadCorrupted(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	cache, cleanup := testCache(t, nil)
+	defer cleanup()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Token = "a.atlasv1.b"
+	client.Cache = cache
+
+	v, err := newChecksumVerifier(testDownloadVersion(1).Metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(cache.filePath(v), []byte("corrupted"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	w := new(memWriterAt)
+	if _, err := client.DownloadArtifact(testDownloadVersion(1), w, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.buf, testArtifactFile) {
+		t.Fatal("bad content")
+	}
+}
+
+func TestCache_downloadBadChecksum(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	cache, cleanup := testCache(t, nil)
+	defer cleanup()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Token = "a.atlasv1.b"
+	client.Cache = cache
+
+	// A file outside the cache that the checksum points at
+	victim := filepath.Join(cache.dir, "victim")
+	if err := ioutil.WriteFile(victim, []byte("keep me"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cache would look for "files/sha256-x/../../victim"
+	av := testDownloadVersion(1)
+	av.Metadata[MetadataChecksumKey] = "x/../../victim"
+	if _, err := client.DownloadArtifact(av, new(memWriterAt), nil); err == nil {
+		t.Fatal("expected error, but nothing was returned")
+	}
+
+	if _, err := os.Stat(victim); err != nil {
+		t.Fatalf("expected %s to be kept: %s", victim, err)
+	}
+	path := "/api/v1/artifacts/hashicorp/existing/vagrant-box/1/file"
+	if n := server.attemptCount(path); n != 0 {
+		t.Fatalf("expected no requests, got %d", n)
+	}
+}
+
+func TestCache_evict(t *testing.T) {
+	cache, cleanup := testCache(t, &CacheOptions{MaxFileBytes: 25})
+	defer cleanup()
+
+	// Files a, b and c were used in that order
+	now := time.Now()
+	for i, name := range []string{"a", "b", "c"} {
+		path := filepath.Join(cache.filesDir(), name)
+		if err := ioutil.WriteFile(path, make([]byte, 10), 0600); err != nil {
+			t.Fatal(err)
+		}
+		used := now.Add(time.Duration(i-3) * time.Minute)
+		if err := os.Chtimes(path, used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cache.evict("c"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, exists := range map[string]bool{"a": false, "b": true, "c": true} {
+		_, err := os.Stat(filepath.Join(cache.filesDir(), name))
+		if exists != (err == nil) {
+			t.Fatalf("%s: expected exists to be %t", name, exists)
+		}
+	}
+
+	// The kept file stays even if it doesn't fit by itself
+	cache.opts.MaxFileBytes = 5
+	if err := cache.evict("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, exists := range map[string]bool{"b": true, "c": false} {
+		_, err := os.Stat(filepath.Join(cache.filesDir(), name))
+		if exists != (err == nil) {
+			t.Fatalf("%s: expected exists to be %t", name, exists)
+		}
+	}
+}
+
+func TestCache_downloadTooLarge(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	// The file doesn't fit in the cache by itself
+	cache, cleanup := testCache(t, &CacheOptions{MaxFileBytes: 1})
+	defer cleanup()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Token = "a.atlasv1.b"
+	client.Cache = cache
+
+	w := new(memWriterAt)
+	if _, err := client.DownloadArtifact(testDownloadVersion(1), w, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(w.buf, testArtifactFile) {
+		t.Fatal("bad content")
+	}
+}
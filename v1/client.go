@@ -2,17 +2,21 @@ package atlas
 
 import (
 	"bytes"
+	"context"
+	"crypto/md5"
 	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"runtime"
-	"strings"
+	"sync"
 
 	"github.com/hashicorp/go-cleanhttp"
 	"github.com/hashicorp/go-rootcerts"
@@ -36,34 +40,30 @@ const (
 
 	// atlasTLSNoVerifyEnvVar disables TLS verification, similar to curl -k
 	// This defaults to false (verify) and will change to true (skip
-	// verification) with any non-empty value
+	// verification) with any non-empty value other than a false one, such
+	// as "0" or "false" (see strconv.ParseBool)
 	atlasTLSNoVerifyEnvVar = "ATLAS_TLS_NOVERIFY"
 
 	// atlasTokenHeader is the header key used for authenticating with Atlas
 	atlasTokenHeader = "X-Atlas-Token"
+
+	// maxLogBodySize is the most of a response body that is logged.
+	maxLogBodySize = 64 * 1024
+
+	// maxErrorBodySize is the most of an error response body that is kept
+	// in an APIError.
+	maxErrorBodySize = 1024 * 1024
+
+	// maxDiscardBodySize is the most of an unread response body that is
+	// read before closing it. Beyond this, it is cheaper to drop the
+	// connection than to drain it.
+	maxDiscardBodySize = 256 * 1024
 )
 
 var projectURL = "https://github.com/hashicorp/atlas-go"
 var userAgent = fmt.Sprintf("AtlasGo/1.0 (+%s; %s)",
 	projectURL, runtime.Version())
 
-// ErrAuth is the error returned if a 401 is returned by an API request.
-var ErrAuth = fmt.Errorf("authentication failed")
-
-// ErrNotFound is the error returned if a 404 is returned by an API request.
-var ErrNotFound = fmt.Errorf("resource not found")
-
-// RailsError represents an error that was returned from the Rails server.
-type RailsError struct {
-	Errors []string `json:"errors"`
-}
-
-// Error collects all of the errors in the RailsError and returns a comma-
-// separated list of the errors that were returned from the server.
-func (re *RailsError) Error() string {
-	return strings.Join(re.Errors, ", ")
-}
-
 // Client represents a single connection to a Atlas API endpoint.
 type Client struct {
 	// URL is the full endpoint address to the Atlas server including the
@@ -79,18 +79,65 @@ type Client struct {
 	// DefaultHeaders is a set of headers that will be added to every request.
 	// This minimally includes the atlas user-agent string.
 	DefaultHeader http.Header
+
+	// RetryPolicy controls how transient failures are retried. NewClient
+	// sets this to DefaultRetryPolicy(); set it to nil to disable retries.
+	RetryPolicy *RetryPolicy
+
+	// Logger receives the client's log messages. If nil, nothing is logged.
+	Logger Logger
+
+	// Middleware wraps every request the client sends. See Use.
+	Middleware []Middleware
+
+	// RateLimiter, if set, limits the rate and concurrency of requests.
+	RateLimiter *RateLimiter
+
+	// UploadOptions configure progress reporting and bandwidth limits for
+	// file uploads. See also UploadArtifactOpts.Upload.
+	UploadOptions *UploadOptions
+
+	// Cache, if set, caches artifact search results and downloaded artifact
+	// files on disk.
+	Cache *Cache
+
+	// secrets are the values that are redacted from log messages.
+	secrets secrets
+
+	// err, if set, is returned by every request. DefaultClient uses it when
+	// the environment doesn't describe a usable client.
+	err error
 }
 
-// DefaultClient returns a client that connects to the Atlas API.
+// DefaultClient returns a client that connects to the Atlas API, configured
+// from the configuration file and the environment.
+//
+// If the configuration file can't be used, for example because it is
+// malformed or ATLAS_PROFILE names a profile it doesn't have, the client is
+// configured from the environment only. If the environment can't be used
+// either, for example because it sets an invalid address, every request
+// made with the client returns the error. Use NewDefaultClient to get the
+// error up front instead.
 func DefaultClient() *Client {
+	client, err := NewDefaultClient()
+	if err == nil {
+		return client
+	}
+
 	atlasEndpoint := os.Getenv(atlasEndpointEnvVar)
 	if atlasEndpoint == "" {
 		atlasEndpoint = atlasDefaultEndpoint
 	}
 
-	client, err := NewClient(atlasEndpoint)
+	client, err = NewClient(atlasEndpoint)
 	if err != nil {
-		panic(err)
+		client = &Client{
+			URL:           new(url.URL),
+			DefaultHeader: make(http.Header),
+			RetryPolicy:   DefaultRetryPolicy(),
+			HTTPClient:    cleanhttp.DefaultClient(),
+			err:           fmt.Errorf("client: invalid Atlas configuration: %s", err),
+		}
 	}
 
 	return client
@@ -101,30 +148,40 @@ func DefaultClient() *Client {
 // an empty http.Client, but this can be changed programmatically by setting
 // client.HTTPClient. The user can also programmatically set the URL as a
 // *url.URL.
+//
+// The token and TLS settings are read from the environment. The
+// configuration file is not used; see NewClientFromConfig for that.
 func NewClient(urlString string) (*Client, error) {
 	if len(urlString) == 0 {
 		return nil, fmt.Errorf("client: missing url")
 	}
 
-	parsedURL, err := url.Parse(urlString)
+	return newClient(&ClientConfig{
+		Address:       urlString,
+		Token:         os.Getenv(atlasTokenEnvVar),
+		CAFile:        os.Getenv(atlasCAFileEnvVar),
+		CAPath:        os.Getenv(atlasCAPathEnvVar),
+		TLSSkipVerify: envTLSSkipVerify(),
+	})
+}
+
+// newClient creates a new Client from a fully resolved ClientConfig.
+func newClient(config *ClientConfig) (*Client, error) {
+	parsedURL, err := url.Parse(config.Address)
 	if err != nil {
 		return nil, err
 	}
 
-	token := os.Getenv("ATLAS_TOKEN")
-	if token != "" {
-		log.Printf("[DEBUG] using ATLAS_TOKEN (%s)", maskString(token))
-	}
-
 	client := &Client{
 		URL:           parsedURL,
-		Token:         token,
+		Token:         config.Token,
 		DefaultHeader: make(http.Header),
+		RetryPolicy:   DefaultRetryPolicy(),
 	}
 
 	client.DefaultHeader.Set("User-Agent", userAgent)
 
-	if err := client.init(); err != nil {
+	if err := client.init(config); err != nil {
 		return nil, err
 	}
 
@@ -132,15 +189,15 @@ func NewClient(urlString string) (*Client, error) {
 }
 
 // init() sets defaults on the client.
-func (c *Client) init() error {
+func (c *Client) init(config *ClientConfig) error {
 	c.HTTPClient = cleanhttp.DefaultClient()
 	tlsConfig := &tls.Config{}
-	if os.Getenv(atlasTLSNoVerifyEnvVar) != "" {
+	if config.TLSSkipVerify != nil && *config.TLSSkipVerify {
 		tlsConfig.InsecureSkipVerify = true
 	}
 	err := rootcerts.ConfigureTLS(tlsConfig, &rootcerts.Config{
-		CAFile: os.Getenv(atlasCAFileEnvVar),
-		CAPath: os.Getenv(atlasCAPathEnvVar),
+		CAFile: config.CAFile,
+		CAPath: config.CAPath,
 	})
 	if err != nil {
 		return err
@@ -167,20 +224,42 @@ type RequestOptions struct {
 
 // Request creates a new HTTP request using the given verb and sub path.
 func (c *Client) Request(verb, spath string, ro *RequestOptions) (*http.Request, error) {
-	log.Printf("[INFO] request: %s %s", verb, spath)
+	return c.RequestContext(context.Background(), verb, spath, ro)
+}
+
+// RequestContext creates a new HTTP request using the given verb and sub
+// path. The given context is attached to the request, so cancelling it or
+// hitting its deadline aborts the in-flight call, including any body that is
+// still being uploaded.
+func (c *Client) RequestContext(ctx context.Context, verb, spath string, ro *RequestOptions) (*http.Request, error) {
+	return c.requestURL(ctx, verb, c.endpointURL(spath), ro)
+}
+
+// endpointURL returns the URL of the given sub path on the Atlas server.
+func (c *Client) endpointURL(spath string) *url.URL {
+	u := *c.URL
+	u.Path = path.Join(c.URL.Path, spath)
+	u.RawPath = ""
+	return &u
+}
+
+// requestURL is like RequestContext, but takes the full URL of the request
+// for paths that need escaping, such as tfVarURL.
+func (c *Client) requestURL(ctx context.Context, verb string, u *url.URL, ro *RequestOptions) (*http.Request, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	c.logger().Infof("request: %s %s", verb, u.EscapedPath())
 
 	// Ensure we have a RequestOptions struct (passing nil is an acceptable)
 	if ro == nil {
 		ro = new(RequestOptions)
 	}
 
-	// Create a new URL with the appended path
-	u := *c.URL
-	u.Path = path.Join(c.URL.Path, spath)
-
 	// Add the token and other params
 	if c.Token != "" {
-		log.Printf("[DEBUG] request: appending token (%s)", maskString(c.Token))
+		c.logger().Debugf("request: appending token (%s)", maskString(c.Token))
 		if ro.Headers == nil {
 			ro.Headers = make(map[string]string)
 		}
@@ -188,35 +267,143 @@ func (c *Client) Request(verb, spath string, ro *RequestOptions) (*http.Request,
 		ro.Headers[atlasTokenHeader] = c.Token
 	}
 
-	return c.rawRequest(verb, &u, ro)
+	return c.rawRequest(ctx, verb, u, ro)
 }
 
-func (c *Client) putFile(rawURL string, r io.Reader, size int64) error {
-	log.Printf("[INFO] putting file: %s", rawURL)
+// putFile uploads a file to the given URL, in chunks if the upload options
+// ask for it and the file supports it. If opts is nil, the client's
+// UploadOptions are used.
+func (c *Client) putFile(ctx context.Context, rawURL string, r io.Reader, size int64,
+	opts *UploadOptions) error {
+	_, err := c.putFileChecksum(ctx, rawURL, r, size, "", opts)
+	return err
+}
+
+// putFileChecksum is like putFile, but fails with a *ChecksumError unless
+// the data sent has the given hex-encoded SHA-256 checksum. An empty
+// checksum isn't checked.
+//
+// It returns the checksum of the file. Chunks are sent out of order, so the
+// checksum of a file uploaded in chunks is the one the storage reports, if
+// the given checksum is empty.
+func (c *Client) putFileChecksum(ctx context.Context, rawURL string, r io.Reader, size int64,
+	sum string, opts *UploadOptions) (string, error) {
+	c.logger().Infof("putting file: %s", rawURL)
+
+	opts = c.uploadOptions(opts)
+	if opts.ChunkSize > 0 && size > opts.ChunkSize {
+		if source, ok := r.(chunkSource); ok {
+			return c.putChunked(ctx, rawURL, source, size, sum, opts)
+		}
+		c.logger().Debugf("file can't be read in chunks, uploading it in one request")
+	}
+
+	sent, err := c.put(ctx, rawURL, r, size, nil, newTransfer(opts, size))
+	if err != nil {
+		return "", err
+	}
+
+	if sum != "" && sent != sum {
+		return "", &ChecksumError{Type: "sha256", Expected: sum, Actual: sent}
+	}
+
+	return sent, nil
+}
 
+// put uploads size bytes from r to the given URL in a single PUT request
+// with the given extra headers, accounting for it in t. It returns the
+// hex-encoded SHA-256 checksum of the data sent, and fails with a
+// *ChecksumError if the storage reports a different one. The data is hashed
+// as it is sent; it is only read beforehand to send its Content-MD5.
+func (c *Client) put(ctx context.Context, rawURL string, r io.Reader, size int64,
+	headers map[string]string, t *transfer) (string, error) {
 	url, err := url.Parse(rawURL)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	request, err := c.rawRequest("PUT", url, &RequestOptions{
-		Body:       r,
+	// Remember where the source starts so the upload can be retried by
+	// rewinding it. Sources that can't seek are never retried.
+	seeker, canSeek := r.(io.Seeker)
+	var offset int64
+	if canSeek {
+		offset, err = seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			canSeek = false
+		}
+	}
+
+	// Stop reading from the source as soon as the context is done. Empty
+	// bodies are left alone so the request keeps a zero Content-Length.
+	// Report progress, limit bandwidth and hash the data as it is sent.
+	body := r
+	var ur *uploadReader
+	if r != nil && size > 0 {
+		ur = newUploadReader(ctx, r, size, t)
+		body = &contextReader{ctx: ctx, r: ur}
+	}
+
+	request, err := c.rawRequest(ctx, "PUT", url, &RequestOptions{
+		Body:       body,
 		BodyLength: size,
+		Headers:    headers,
 	})
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	if _, err := checkResp(c.HTTPClient.Do(request)); err != nil {
-		return err
+	// Let the storage verify the data if asked to. The digest has to be sent
+	// before the data, so it's only sent for sources that can be read twice.
+	var md5sum string
+	if ur != nil && t.contentMD5 {
+		if canSeek {
+			digest, err := hashSection(ctx, md5.New(), r, seeker, offset, size)
+			if err != nil {
+				return "", err
+			}
+			request.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(digest))
+			md5sum = hex.EncodeToString(digest)
+		} else {
+			c.logger().Warnf("not sending Content-MD5 for %s: the file can't be read twice", url.Path)
+		}
 	}
 
-	return nil
+	if canSeek && request.GetBody == nil {
+		request.GetBody = func() (io.ReadCloser, error) {
+			if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+				return nil, err
+			}
+			if ur != nil {
+				ur.reset()
+			}
+			return ioutil.NopCloser(body), nil
+		}
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return "", err
+	}
+	discardResp(response)
+
+	var sent string
+	if ur != nil {
+		sent = hex.EncodeToString(ur.sha256.Sum(nil))
+	}
+	if err := verifyStorage(response.Header, sent, md5sum); err != nil {
+		return "", err
+	}
+
+	return sent, nil
 }
 
-// rawRequest accepts a verb, URL, and RequestOptions struct and returns the
-// constructed http.Request and any errors that occurred
-func (c *Client) rawRequest(verb string, u *url.URL, ro *RequestOptions) (*http.Request, error) {
+// rawRequest accepts a context, verb, URL, and RequestOptions struct and
+// returns the constructed http.Request and any errors that occurred
+func (c *Client) rawRequest(ctx context.Context, verb string, u *url.URL, ro *RequestOptions) (*http.Request, error) {
+	if ctx == nil {
+		return nil, fmt.Errorf("client: missing context")
+	}
+
 	if verb == "" {
 		return nil, fmt.Errorf("client: missing verb")
 	}
@@ -229,18 +416,23 @@ func (c *Client) rawRequest(verb string, u *url.URL, ro *RequestOptions) (*http.
 		return nil, fmt.Errorf("client: missing RequestOptions")
 	}
 
-	// Add the token and other params
-	var params = make(url.Values)
-	for k, v := range ro.Params {
-		params.Add(k, v)
+	// Add the token and other params. A query that is already part of the
+	// URL (such as a signed storage URL) is left as it is unless there are
+	// params to add.
+	if len(ro.Params) > 0 {
+		params := u.Query()
+		for k, v := range ro.Params {
+			params.Add(k, v)
+		}
+		u.RawQuery = params.Encode()
 	}
-	u.RawQuery = params.Encode()
 
 	// Create the request object
 	request, err := http.NewRequest(verb, u.String(), ro.Body)
 	if err != nil {
 		return nil, err
 	}
+	request = request.WithContext(ctx)
 
 	// set our default headers first
 	for k, v := range c.DefaultHeader {
@@ -257,14 +449,15 @@ func (c *Client) rawRequest(verb string, u *url.URL, ro *RequestOptions) (*http.
 		request.ContentLength = ro.BodyLength
 	}
 
-	log.Printf("[DEBUG] raw request: %#v", request)
+	c.logger().Debugf("raw request: %s %s %v",
+		request.Method, request.URL, redactHeader(request.Header))
 
 	return request, nil
 }
 
 // checkResp wraps http.Client.Do() and verifies that the request was
-// successful. A non-200 request returns an error formatted to included any
-// validation problems or otherwise.
+// successful. A non-200 request returns an *APIError that includes the
+// status, any validation problems and the raw response.
 func checkResp(resp *http.Response, err error) (*http.Response, error) {
 	// If the err is already there, there was an error higher up the chain, so
 	// just return that
@@ -272,19 +465,6 @@ func checkResp(resp *http.Response, err error) (*http.Response, error) {
 		return resp, err
 	}
 
-	log.Printf("[INFO] response: %d (%s)", resp.StatusCode, resp.Status)
-	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, resp.Body); err != nil {
-		log.Printf("[ERR] response: error copying response body")
-	} else {
-		log.Printf("[DEBUG] response: %s", buf.String())
-
-		// We are going to reset the response body, so we need to close the old
-		// one or else it will leak.
-		resp.Body.Close()
-		resp.Body = &bytesReadCloser{&buf}
-	}
-
 	switch resp.StatusCode {
 	case 200:
 		return resp, nil
@@ -294,46 +474,162 @@ func checkResp(resp *http.Response, err error) (*http.Response, error) {
 		return resp, nil
 	case 204:
 		return resp, nil
-	case 400:
-		return nil, parseErr(resp)
-	case 401:
-		return nil, ErrAuth
-	case 404:
-		return nil, ErrNotFound
-	case 422:
-		return nil, parseErr(resp)
+	case 206:
+		return resp, nil
+	default:
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		return nil, newAPIError(resp, body)
+	}
+}
+
+// send sends the request through the client's middleware and HTTPClient and
+// logs the response.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	var release func()
+	if c.RateLimiter != nil {
+		var err error
+		release, err = c.RateLimiter.Acquire(req.Context())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.roundTrip()(req)
+	if err != nil {
+		if release != nil {
+			release()
+		}
+		return resp, err
+	}
+
+	if c.RateLimiter != nil {
+		c.RateLimiter.Adapt(resp)
+	}
+
+	// Middleware may build its own responses, so make sure they have
+	// everything the rest of the client expects.
+	if resp.Body == nil {
+		resp.Body = http.NoBody
+	}
+	if resp.Request == nil {
+		resp.Request = req
+	}
+
+	// The request is in flight until its body has been read, so that
+	// streamed downloads count against the limit too
+	if release != nil {
+		resp.Body = &releaseCloser{ReadCloser: resp.Body, release: release}
+	}
+
+	c.logResponse(resp)
+	return resp, nil
+}
+
+// releaseCloser calls release the first time the body is closed.
+type releaseCloser struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (rc *releaseCloser) Close() error {
+	err := rc.ReadCloser.Close()
+	rc.once.Do(rc.release)
+	return err
+}
+
+// logResponse logs the status of the response and, if debug logging is
+// enabled, the start of its body. Only the logged part of the body is
+// buffered; the rest is still streamed to whoever reads the response.
+func (c *Client) logResponse(resp *http.Response) {
+	c.logger().Infof("response: %d (%s)", resp.StatusCode, resp.Status)
+	if !c.debugEnabled() {
+		return
+	}
+
+	// Terraform state holds the outputs and attributes of every resource,
+	// often including passwords, and can't be redacted field by field.
+	if resp.Request != nil && isStatePath(resp.Request.URL.Path) {
+		c.logger().Debugf("response: (Terraform state not logged)")
+		return
+	}
+
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(resp.Body, maxLogBodySize+1))
+	if err != nil {
+		c.logger().Errorf("response: error copying response body")
+	}
+
+	// Secrets in the body, such as tokens, are masked before it is logged,
+	// since the caller only gets to register them once it has decoded it.
+	body, truncated := buf.Bytes(), n > maxLogBodySize
+	if truncated {
+		body = body[:maxLogBodySize]
+	}
+	switch logged, ok := c.redactBody(body, truncated); {
+	case !ok:
+		c.logger().Debugf("response: (%d bytes of JSON not logged, it can't be redacted)", n)
+	case truncated:
+		c.logger().Debugf("response: %s... (truncated)", logged)
 	default:
-		return nil, fmt.Errorf("client: %s", resp.Status)
+		c.logger().Debugf("response: %s", logged)
+	}
+
+	// Put back what we read in front of the rest of the body
+	resp.Body = &multiReadCloser{
+		Reader: io.MultiReader(&buf, resp.Body),
+		Closer: resp.Body,
 	}
 }
 
-// parseErr is used to take an error JSON response and return a single string
-// for use in error messages.
-func parseErr(r *http.Response) error {
-	re := &RailsError{}
+// redactHeader returns a copy of the header with the Atlas token masked.
+func redactHeader(h http.Header) http.Header {
+	result := make(http.Header, len(h))
+	for k, v := range h {
+		result[k] = v
+	}
 
-	if err := decodeJSON(r, &re); err != nil {
-		return fmt.Errorf("error decoding JSON body: %s", err)
+	if token := h.Get(atlasTokenHeader); token != "" {
+		result.Set(atlasTokenHeader, maskString(token))
 	}
 
-	return re
+	return result
 }
 
-// decodeJSON is used to JSON decode a body into an interface.
+// decodeJSON is used to JSON decode a body into an interface. The body is
+// decoded as it is read, and closed afterwards.
 func decodeJSON(resp *http.Response, out interface{}) error {
-	defer resp.Body.Close()
+	defer discardResp(resp)
 	dec := json.NewDecoder(resp.Body)
 	return dec.Decode(out)
 }
 
-// bytesReadCloser is a simple wrapper around a bytes buffer that implements
-// Close as a noop.
-type bytesReadCloser struct {
-	*bytes.Buffer
+// discardResp reads what is left of the response body, up to a limit, and
+// closes it so that the connection can be reused.
+func discardResp(resp *http.Response) {
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxDiscardBodySize))
+	resp.Body.Close()
 }
 
-func (nrc *bytesReadCloser) Close() error {
-	// we don't actually have to do anything here, since the buffer is just some
-	// data in memory  and the error is initialized to no-error
-	return nil
+// multiReadCloser reads from Reader and closes Closer.
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// contextReader wraps an io.Reader and stops reading as soon as the context
+// is done. This ensures a cancelled upload doesn't keep pulling data from
+// the source (for example, a large archive on disk).
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return cr.r.Read(p)
 }
@@ -1,6 +1,9 @@
 package atlas
 
 import (
+	"context"
+	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
@@ -140,7 +143,7 @@ func TestLogin_serverErrorMessage(t *testing.T) {
 		t.Fatal("expected error, but nothing was returned")
 	}
 
-	if err != ErrAuth {
+	if !errors.Is(err, ErrAuth) {
 		t.Fatalf("bad: %s", err)
 	}
 }
@@ -208,6 +211,61 @@ func TestRequest_getsData(t *testing.T) {
 	}
 }
 
+func TestRequest_percentInPath(t *testing.T) {
+	client, err := NewClient("https://atlas.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A "%" in a name is sent as is, not taken as an escape
+	request, err := client.Request("GET", "/api/v1/artifacts/hashicorp/a%2Fb", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "/api/v1/artifacts/hashicorp/a%252Fb"
+	if request.URL.EscapedPath() != expected {
+		t.Fatalf("expected %q to be %q", request.URL.EscapedPath(), expected)
+	}
+}
+
+func TestRequestContext_canceled(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	request, err := client.RequestContext(ctx, "GET", "/_status/200", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := checkResp(client.HTTPClient.Do(request)); err == nil {
+		t.Fatal("expected error, but nothing was returned")
+	}
+}
+
+func TestContextReader_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &contextReader{ctx: ctx, r: strings.NewReader("hello")}
+
+	buf := make([]byte, 2)
+	if _, err := r.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if _, err := r.Read(buf); err != context.Canceled {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
 func TestRequest_railsError(t *testing.T) {
 	server := newTestAtlasServer(t)
 	defer server.Stop()
@@ -234,8 +292,12 @@ func TestRequest_railsError(t *testing.T) {
 		},
 	}
 
-	if !reflect.DeepEqual(err, expected) {
-		t.Fatalf("expected %+v to be %+v", err, expected)
+	var re *RailsError
+	if !errors.As(err, &re) {
+		t.Fatalf("bad error: %#v", err)
+	}
+	if !reflect.DeepEqual(re, expected) {
+		t.Fatalf("expected %+v to be %+v", re, expected)
 	}
 }
 
@@ -258,7 +320,7 @@ func TestRequest_notFoundError(t *testing.T) {
 		t.Fatal("expected error, but nothing was returned")
 	}
 
-	if err != ErrNotFound {
+	if !errors.Is(err, ErrNotFound) {
 		t.Fatalf("bad error: %#v", err)
 	}
 }
@@ -292,6 +354,69 @@ func TestRequestJSON_decodesData(t *testing.T) {
 	}
 }
 
+func TestResponse_streamsWithoutDebug(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request, err := client.Request("GET", "/_large", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := client.do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if _, ok := response.Body.(*multiReadCloser); ok {
+		t.Fatal("response body should not be buffered")
+	}
+}
+
+func TestResponse_logsTruncatedBody(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := new(testLogger)
+	client.Logger = l
+
+	request, err := client.Request("GET", "/_large", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := client.do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body) != maxLogBodySize*2 {
+		t.Fatalf("bad body length: %d", len(body))
+	}
+
+	if !strings.Contains(l.String(), "... (truncated)") {
+		t.Fatal("expected the logged body to be truncated")
+	}
+	if len(l.String()) > maxLogBodySize+1024 {
+		t.Fatalf("logged too much: %d bytes", len(l.String()))
+	}
+}
+
 // check that our DefaultHeader works correctly, along with it providing
 // User-Agent
 func TestClient_defaultHeaders(t *testing.T) {
@@ -0,0 +1,284 @@
+package atlas
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	// atlasConfigEnvVar is the environment variable that overrides the
+	// location of the configuration file.
+	atlasConfigEnvVar = "ATLAS_CONFIG"
+
+	// atlasProfileEnvVar is the environment variable that selects the
+	// profile to use from the configuration file.
+	atlasProfileEnvVar = "ATLAS_PROFILE"
+
+	// atlasTokenEnvVar is the environment variable that holds the Atlas
+	// token.
+	atlasTokenEnvVar = "ATLAS_TOKEN"
+
+	// defaultProfileName is the profile used if none is selected.
+	defaultProfileName = "default"
+)
+
+// ConfigFile is the structure of the Atlas configuration file, which is
+// JSON-encoded and lives at ~/.atlas/config.json by default. For example:
+//
+//	{
+//	  "default_profile": "saas",
+//	  "defaults": { "tls_skip_verify": false },
+//	  "profiles": {
+//	    "saas": { "token": "..." },
+//	    "onprem": {
+//	      "address": "https://atlas.example.com",
+//	      "token": "...",
+//	      "ca_file": "/etc/ssl/example-ca.pem"
+//	    }
+//	  }
+//	}
+type ConfigFile struct {
+	// DefaultProfile is the name of the profile used when none is selected
+	// explicitly or with ATLAS_PROFILE. If empty, "default" is used.
+	DefaultProfile string `json:"default_profile"`
+
+	// Defaults are settings shared by every profile. Settings in a profile
+	// override these.
+	Defaults *Profile `json:"defaults"`
+
+	// Profiles are the named profiles.
+	Profiles map[string]*Profile `json:"profiles"`
+}
+
+// Profile is a set of client settings in the configuration file.
+type Profile struct {
+	Address       string `json:"address"`
+	Token         string `json:"token"`
+	CAFile        string `json:"ca_file"`
+	CAPath        string `json:"ca_path"`
+	TLSSkipVerify *bool  `json:"tls_skip_verify"`
+}
+
+// DefaultConfigPath returns the default location of the configuration file,
+// ~/.atlas/config.json.
+func DefaultConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".atlas", "config.json"), nil
+}
+
+// LoadConfigFile reads and parses the configuration file at the given path.
+func LoadConfigFile(path string) (*ConfigFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var config ConfigFile
+	if err := json.NewDecoder(f).Decode(&config); err != nil {
+		return nil, fmt.Errorf("client: error parsing %s: %s", path, err)
+	}
+
+	return &config, nil
+}
+
+// ClientConfig are the options used to create a Client with
+// NewClientFromConfig.
+//
+// Each setting is taken from the first of these that sets it:
+//
+//  1. the field in ClientConfig
+//  2. the environment: ATLAS_ADDRESS, ATLAS_TOKEN, ATLAS_CAFILE,
+//     ATLAS_CAPATH and ATLAS_TLS_NOVERIFY
+//  3. the selected profile in the configuration file
+//  4. the "defaults" section of the configuration file
+//  5. the built-in default (https://atlas.hashicorp.com for the address)
+//
+// The exception is ATLAS_TOKEN: if a profile is selected explicitly, with
+// Profile or ATLAS_PROFILE, the token from the environment is only used
+// along with an address from the environment. Otherwise a token meant for
+// one server would be sent to the address of the selected profile.
+//
+// TLSSkipVerify is nil when it isn't set, so that an explicit false in a
+// higher source turns off skipping TLS verification asked for by a lower
+// one. Use Bool to set it. It defaults to verifying.
+type ClientConfig struct {
+	Address       string
+	Token         string
+	CAFile        string
+	CAPath        string
+	TLSSkipVerify *bool
+
+	// Profile selects the profile from the configuration file. If empty,
+	// ATLAS_PROFILE is used, then the file's default_profile, then
+	// "default". Selecting a profile that doesn't exist is an error, unless
+	// it is the implicit "default" profile.
+	Profile string
+
+	// ConfigPath is the path to the configuration file. If empty,
+	// ATLAS_CONFIG is used, then DefaultConfigPath. A missing file is an
+	// error only if its path was given explicitly.
+	ConfigPath string
+}
+
+// NewDefaultClient creates a client configured from the configuration file
+// and the environment. It is the same as NewClientFromConfig(nil).
+func NewDefaultClient() (*Client, error) {
+	return NewClientFromConfig(nil)
+}
+
+// NewClientFromConfig creates a new Client from the given ClientConfig, the
+// environment and the configuration file, in that order of precedence. See
+// ClientConfig for details. A nil config is the same as an empty one.
+func NewClientFromConfig(config *ClientConfig) (*Client, error) {
+	resolved, err := resolveConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return newClient(resolved)
+}
+
+// resolveConfig merges the given config with the environment and the
+// configuration file, returning a config with every setting filled in.
+func resolveConfig(config *ClientConfig) (*ClientConfig, error) {
+	if config == nil {
+		config = new(ClientConfig)
+	}
+
+	file, err := loadConfig(config.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := file.profile(config.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the address and token of an explicitly selected profile together
+	envToken := os.Getenv(atlasTokenEnvVar)
+	explicit := firstNonEmpty(config.Profile, os.Getenv(atlasProfileEnvVar)) != ""
+	if explicit && os.Getenv(atlasEndpointEnvVar) == "" {
+		envToken = ""
+	}
+
+	result := *config
+	result.Address = firstNonEmpty(config.Address, os.Getenv(atlasEndpointEnvVar),
+		profile.Address, file.Defaults.Address, atlasDefaultEndpoint)
+	result.Token = firstNonEmpty(config.Token, envToken,
+		profile.Token, file.Defaults.Token)
+	result.CAFile = firstNonEmpty(config.CAFile, os.Getenv(atlasCAFileEnvVar),
+		profile.CAFile, file.Defaults.CAFile)
+	result.CAPath = firstNonEmpty(config.CAPath, os.Getenv(atlasCAPathEnvVar),
+		profile.CAPath, file.Defaults.CAPath)
+	result.TLSSkipVerify = Bool(false)
+	if v := firstSet(config.TLSSkipVerify, envTLSSkipVerify(),
+		profile.TLSSkipVerify, file.Defaults.TLSSkipVerify); v != nil {
+		result.TLSSkipVerify = Bool(*v)
+	}
+
+	return &result, nil
+}
+
+// loadConfig loads the configuration file from the given path, or from the
+// default location if path is empty. A missing file at the default location
+// is treated as an empty configuration.
+func loadConfig(path string) (*ConfigFile, error) {
+	explicit := true
+	if path == "" {
+		path = os.Getenv(atlasConfigEnvVar)
+	}
+	if path == "" {
+		explicit = false
+
+		var err error
+		path, err = DefaultConfigPath()
+		if err != nil {
+			// Without a home directory there can't be a default file
+			return &ConfigFile{Defaults: new(Profile)}, nil
+		}
+	}
+
+	file, err := LoadConfigFile(path)
+	if os.IsNotExist(err) && !explicit {
+		file, err = new(ConfigFile), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if file.Defaults == nil {
+		file.Defaults = new(Profile)
+	}
+
+	return file, nil
+}
+
+// profile returns the profile with the given name, falling back to
+// ATLAS_PROFILE and the default profile if name is empty.
+func (f *ConfigFile) profile(name string) (*Profile, error) {
+	name = firstNonEmpty(name, os.Getenv(atlasProfileEnvVar), f.DefaultProfile)
+	if name == "" {
+		if p, ok := f.Profiles[defaultProfileName]; ok && p != nil {
+			return p, nil
+		}
+
+		return new(Profile), nil
+	}
+
+	p, ok := f.Profiles[name]
+	if !ok || p == nil {
+		return nil, fmt.Errorf("client: unknown profile %q", name)
+	}
+
+	return p, nil
+}
+
+// envTLSSkipVerify returns whether ATLAS_TLS_NOVERIFY asks to skip TLS
+// verification, or nil if it isn't set.
+func envTLSSkipVerify() *bool {
+	v := os.Getenv(atlasTLSNoVerifyEnvVar)
+	if v == "" {
+		return nil
+	}
+
+	// Any value other than a false one skips verification
+	skip, err := strconv.ParseBool(v)
+	return Bool(skip || err != nil)
+}
+
+// Bool returns a pointer to the given bool, for setting
+// ClientConfig.TLSSkipVerify.
+func Bool(v bool) *bool {
+	return &v
+}
+
+// firstSet returns the first of the given bools that isn't nil.
+func firstSet(values ...*bool) *bool {
+	for _, v := range values {
+		if v != nil {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// firstNonEmpty returns the first of the given strings that isn't empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,278 @@
+package atlas
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfigFile = `
+{
+  "default_profile": "saas",
+  "defaults": { "ca_path": "/etc/ssl/certs" },
+  "profiles": {
+    "saas": { "token": "saas-token" },
+    "onprem": {
+      "address": "https://atlas.example.com",
+      "token": "onprem-token",
+      "tls_skip_verify": true
+    }
+  }
+}
+`
+
+// testConfigEnv writes the given configuration file, points ATLAS_CONFIG at
+// it and clears the other environment variables the client reads. The
+// returned function restores the environment.
+func testConfigEnv(t *testing.T, contents string) func() {
+	dir, err := ioutil.TempDir("", "atlas-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	vars := []string{
+		atlasConfigEnvVar, atlasProfileEnvVar, atlasEndpointEnvVar,
+		atlasTokenEnvVar, atlasCAFileEnvVar, atlasCAPathEnvVar,
+		atlasTLSNoVerifyEnvVar,
+	}
+	old := make(map[string]string)
+	for _, v := range vars {
+		old[v] = os.Getenv(v)
+		os.Setenv(v, "")
+	}
+	os.Setenv(atlasConfigEnvVar, path)
+
+	return func() {
+		for k, v := range old {
+			os.Setenv(k, v)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestResolveConfig_defaultProfile(t *testing.T) {
+	defer testConfigEnv(t, testConfigFile)()
+
+	config, err := resolveConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Address != atlasDefaultEndpoint {
+		t.Fatalf("bad address: %q", config.Address)
+	}
+	if config.Token != "saas-token" {
+		t.Fatalf("bad token: %q", config.Token)
+	}
+	if config.CAPath != "/etc/ssl/certs" {
+		t.Fatalf("bad ca path: %q", config.CAPath)
+	}
+	if *config.TLSSkipVerify {
+		t.Fatal("expected TLS verification")
+	}
+}
+
+func TestResolveConfig_precedence(t *testing.T) {
+	defer testConfigEnv(t, testConfigFile)()
+
+	os.Setenv(atlasProfileEnvVar, "onprem")
+	os.Setenv(atlasTokenEnvVar, "env-token")
+
+	config, err := resolveConfig(&ClientConfig{
+		CAPath: "/opt/certs",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// From the profile
+	if config.Address != "https://atlas.example.com" {
+		t.Fatalf("bad address: %q", config.Address)
+	}
+	if !*config.TLSSkipVerify {
+		t.Fatal("expected TLS verification to be skipped")
+	}
+
+	// The token goes with the selected profile's address
+	if config.Token != "onprem-token" {
+		t.Fatalf("bad token: %q", config.Token)
+	}
+
+	// Explicit settings override everything
+	if config.CAPath != "/opt/certs" {
+		t.Fatalf("bad ca path: %q", config.CAPath)
+	}
+
+	config, err = resolveConfig(&ClientConfig{Profile: "saas"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Address != atlasDefaultEndpoint {
+		t.Fatalf("bad address: %q", config.Address)
+	}
+}
+
+func TestResolveConfig_envToken(t *testing.T) {
+	defer testConfigEnv(t, testConfigFile)()
+	os.Setenv(atlasTokenEnvVar, "env-token")
+
+	// The environment overrides the default profile
+	config, err := resolveConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Token != "env-token" {
+		t.Fatalf("bad token: %q", config.Token)
+	}
+
+	// But not one that was selected, unless it sets the address too
+	config, err = resolveConfig(&ClientConfig{Profile: "onprem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Address != "https://atlas.example.com" || config.Token != "onprem-token" {
+		t.Fatalf("bad: %q %q", config.Address, config.Token)
+	}
+
+	os.Setenv(atlasEndpointEnvVar, "https://atlas.test")
+	config, err = resolveConfig(&ClientConfig{Profile: "onprem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Address != "https://atlas.test" || config.Token != "env-token" {
+		t.Fatalf("bad: %q %q", config.Address, config.Token)
+	}
+}
+
+func TestResolveConfig_tlsSkipVerify(t *testing.T) {
+	defer testConfigEnv(t, testConfigFile)()
+
+	cases := []struct {
+		env      string
+		config   *bool
+		expected bool
+	}{
+		{"", nil, true},
+		{"", Bool(false), false},
+		{"false", nil, false},
+		{"0", Bool(true), true},
+		{"yes", nil, true},
+	}
+
+	// The onprem profile skips TLS verification
+	for _, tc := range cases {
+		os.Setenv(atlasTLSNoVerifyEnvVar, tc.env)
+
+		config, err := resolveConfig(&ClientConfig{Profile: "onprem", TLSSkipVerify: tc.config})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *config.TLSSkipVerify != tc.expected {
+			t.Errorf("env %q, config %v: expected %t", tc.env, tc.config, tc.expected)
+		}
+	}
+}
+
+func TestResolveConfig_unknownProfile(t *testing.T) {
+	defer testConfigEnv(t, testConfigFile)()
+
+	_, err := resolveConfig(&ClientConfig{Profile: "nope"})
+	if err == nil {
+		t.Fatal("expected error, but nothing was returned")
+	}
+
+	expected := `unknown profile "nope"`
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("expected %q to contain %q", err.Error(), expected)
+	}
+}
+
+func TestResolveConfig_missingFile(t *testing.T) {
+	defer testConfigEnv(t, testConfigFile)()
+
+	_, err := resolveConfig(&ClientConfig{ConfigPath: "/nonexistent/config.json"})
+	if err == nil {
+		t.Fatal("expected error, but nothing was returned")
+	}
+}
+
+func TestNewClientFromConfig_badFile(t *testing.T) {
+	defer testConfigEnv(t, `{"profiles": `)()
+
+	_, err := NewClientFromConfig(nil)
+	if err == nil {
+		t.Fatal("expected error, but nothing was returned")
+	}
+
+	expected := "error parsing"
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("expected %q to contain %q", err.Error(), expected)
+	}
+}
+
+func TestDefaultClient_badFile(t *testing.T) {
+	defer testConfigEnv(t, `{"profiles": `)()
+
+	var buf bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&buf)
+
+	client := DefaultClient()
+	if client.URL.String() != atlasDefaultEndpoint {
+		t.Fatalf("expected %q to be %q", client.URL.String(), atlasDefaultEndpoint)
+	}
+
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing to be logged, got %q", buf.String())
+	}
+}
+
+func TestDefaultClient_unknownProfile(t *testing.T) {
+	defer testConfigEnv(t, testConfigFile)()
+	os.Setenv(atlasProfileEnvVar, "nope")
+
+	if client := DefaultClient(); client == nil {
+		t.Fatal("expected a client")
+	}
+}
+
+func TestDefaultClient_badAddress(t *testing.T) {
+	defer testConfigEnv(t, `{"profiles": `)()
+	os.Setenv(atlasEndpointEnvVar, "http://%zz")
+
+	client := DefaultClient()
+	_, err := client.Request("GET", "/api/v1/authenticate", nil)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	expected := "invalid Atlas configuration"
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("expected %q to contain %q", err.Error(), expected)
+	}
+}
+
+func TestNewClientFromConfig(t *testing.T) {
+	defer testConfigEnv(t, testConfigFile)()
+
+	client, err := NewClientFromConfig(&ClientConfig{Profile: "onprem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.URL.String() != "https://atlas.example.com" {
+		t.Fatalf("bad url: %s", client.URL)
+	}
+	if client.Token != "onprem-token" {
+		t.Fatalf("bad token: %q", client.Token)
+	}
+}
@@ -0,0 +1,509 @@
+package atlas
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MetadataChecksumKey is the ArtifactVersion metadata key holding the
+	// hex-encoded checksum of the artifact's file.
+	MetadataChecksumKey = "checksum"
+
+	// MetadataChecksumTypeKey is the ArtifactVersion metadata key holding
+	// the algorithm of the checksum: "md5", "sha1", "sha256" or "sha512".
+	// If it isn't set, "sha256" is assumed.
+	MetadataChecksumTypeKey = "checksum_type"
+)
+
+// DownloadArtifactOpts are the options used to download an artifact file.
+type DownloadArtifactOpts struct {
+	// Progress, if set, is called as the file is downloaded.
+	Progress ProgressFunc
+
+	// Resume is used by DownloadArtifactToFile to continue an earlier,
+	// interrupted download: the data already in the file is kept and only
+	// the rest is downloaded. Without Resume the file is truncated.
+	Resume bool
+}
+
+// ChecksumError is returned when a downloaded file doesn't match the
+// checksum in the artifact version's metadata.
+type ChecksumError struct {
+	Type     string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("client: %s checksum mismatch: expected %s, got %s",
+		e.Type, e.Expected, e.Actual)
+}
+
+// DownloadArtifact downloads the file of the given ArtifactVersion into w,
+// returning the number of bytes written.
+//
+// The request to Atlas is authenticated with the client's token, and the
+// redirect to the storage backend is followed without sending the token
+// along. If the connection fails part way through, the download resumes
+// where it left off with an HTTP Range request, according to the client's
+// RetryPolicy. If the version's metadata has a checksum (see
+// MetadataChecksumKey), the downloaded data is verified against it and a
+// *ChecksumError is returned if it doesn't match.
+func (c *Client) DownloadArtifact(av *ArtifactVersion, w io.WriterAt, opts *DownloadArtifactOpts) (int64, error) {
+	return c.DownloadArtifactContext(context.Background(), av, w, opts)
+}
+
+// DownloadArtifactContext is like DownloadArtifact, but uses the given
+// context for the requests.
+func (c *Client) DownloadArtifactContext(ctx context.Context, av *ArtifactVersion, w io.WriterAt, opts *DownloadArtifactOpts) (int64, error) {
+	v, err := newChecksumVerifier(av.Metadata)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.downloadArtifact(ctx, av, w, 0, v, opts)
+}
+
+// DownloadArtifactToFile downloads the file of the given ArtifactVersion to
+// the given path, returning the size of the file. See DownloadArtifact for
+// details.
+func (c *Client) DownloadArtifactToFile(av *ArtifactVersion, path string, opts *DownloadArtifactOpts) (int64, error) {
+	return c.DownloadArtifactToFileContext(context.Background(), av, path, opts)
+}
+
+// DownloadArtifactToFileContext is like DownloadArtifactToFile, but uses the
+// given context for the requests.
+func (c *Client) DownloadArtifactToFileContext(ctx context.Context, av *ArtifactVersion, path string, opts *DownloadArtifactOpts) (int64, error) {
+	if opts == nil {
+		opts = new(DownloadArtifactOpts)
+	}
+
+	v, err := newChecksumVerifier(av.Metadata)
+	if err != nil {
+		return 0, err
+	}
+
+	flags := os.O_CREATE | os.O_RDWR
+	if !opts.Resume {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var offset int64
+	if opts.Resume {
+		fi, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		offset = fi.Size()
+
+		// The checksum covers the whole file, so include what we have
+		if v != nil {
+			if _, err := io.Copy(v.hash, io.NewSectionReader(f, 0, offset)); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	n, err := c.downloadArtifact(ctx, av, f, offset, v, opts)
+	if err != nil {
+		return n, err
+	}
+
+	return n, f.Close()
+}
+
+// downloadArtifact downloads the artifact file into w, starting at offset.
+// Whole files with a checksum go through the client's Cache, if it has one.
+func (c *Client) downloadArtifact(ctx context.Context, av *ArtifactVersion, w io.WriterAt,
+	offset int64, v *checksumVerifier, opts *DownloadArtifactOpts) (int64, error) {
+	if opts == nil {
+		opts = new(DownloadArtifactOpts)
+	}
+
+	if c.Cache != nil && v != nil && offset == 0 {
+		return c.downloadCached(ctx, av, w, v, opts)
+	}
+
+	return c.fetchArtifact(ctx, av, w, offset, v, opts)
+}
+
+// downloadCached copies the artifact file from the cache into w,
+// downloading it into the cache first if it isn't there.
+func (c *Client) downloadCached(ctx context.Context, av *ArtifactVersion, w io.WriterAt,
+	v *checksumVerifier, opts *DownloadArtifactOpts) (int64, error) {
+	if f := c.Cache.openFile(v); f != nil {
+		c.logger().Infof("using cached artifact: %s/%s (%s) version %d",
+			av.User, av.Name, av.Type, av.Version)
+
+		// Verify the cached file before writing anything, so a corrupted
+		// one can be replaced
+		_, err := io.Copy(v.hash, f)
+		if err == nil {
+			err = v.verify()
+		}
+		if err == nil {
+			_, err = f.Seek(0, io.SeekStart)
+		}
+		if err == nil {
+			n, err := copyAt(w, f)
+			f.Close()
+			if err == nil && opts.Progress != nil {
+				opts.Progress(Progress{Bytes: n, Total: n})
+			}
+			return n, err
+		}
+
+		c.logger().Warnf("discarding cached artifact %s: %s", f.Name(), err)
+		f.Close()
+		os.Remove(f.Name())
+		v.hash.Reset()
+	}
+
+	tmp, err := ioutil.TempFile(c.Cache.filesDir(), ".download-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := c.fetchArtifact(ctx, av, tmp, 0, v, opts); err != nil {
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	// The file was verified as it was downloaded
+	f, err := c.Cache.storeFile(v, tmp.Name())
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return copyAt(w, f)
+}
+
+// copyAt copies r into w from the start.
+func copyAt(w io.WriterAt, r io.Reader) (int64, error) {
+	var offset int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			if _, err := w.WriteAt(buf[:n], offset); err != nil {
+				return offset, err
+			}
+			offset += int64(n)
+		}
+
+		if rerr == io.EOF {
+			return offset, nil
+		}
+		if rerr != nil {
+			return offset, rerr
+		}
+	}
+}
+
+// fetchArtifact downloads the artifact file into w, starting at offset.
+func (c *Client) fetchArtifact(ctx context.Context, av *ArtifactVersion, w io.WriterAt,
+	offset int64, v *checksumVerifier, opts *DownloadArtifactOpts) (int64, error) {
+	u, err := c.ArtifactFileURL(av)
+	if err != nil {
+		return 0, err
+	}
+	if u == nil {
+		return 0, fmt.Errorf("client: artifact %s/%s/%s version %d has no file",
+			av.User, av.Name, av.Type, av.Version)
+	}
+
+	c.logger().Infof("downloading artifact: %s/%s (%s) version %d",
+		av.User, av.Name, av.Type, av.Version)
+
+	return c.fetchFile(ctx, u.Path, w, offset, v, opts)
+}
+
+// fetchFile downloads the file at the given API path into w, starting at
+// offset, resuming it after failures according to the client's RetryPolicy
+// and verifying it if v is set.
+func (c *Client) fetchFile(ctx context.Context, path string, w io.WriterAt,
+	offset int64, v *checksumVerifier, opts *DownloadArtifactOpts) (int64, error) {
+	if opts == nil {
+		opts = new(DownloadArtifactOpts)
+	}
+
+	d := &download{
+		c:        c,
+		ctx:      ctx,
+		path:     path,
+		w:        w,
+		offset:   offset,
+		total:    -1,
+		verifier: v,
+		progress: newProgressTracker(opts.Progress, offset, -1),
+	}
+
+	for attempt := 0; ; attempt++ {
+		resume, err := d.fetch()
+		if err == nil {
+			break
+		}
+
+		policy := c.RetryPolicy
+		if !resume || policy == nil || attempt >= policy.MaxRetries || ctx.Err() != nil {
+			return d.offset, err
+		}
+
+		wait := policy.backoff(attempt, nil)
+		c.logger().Warnf("download interrupted at %d bytes, resuming in %s: %s",
+			d.offset, wait, err)
+
+		if err := sleep(ctx, wait); err != nil {
+			return d.offset, err
+		}
+	}
+
+	if v != nil {
+		if err := v.verify(); err != nil {
+			return d.offset, err
+		}
+	}
+
+	return d.offset, nil
+}
+
+// download is the state of a file download, kept between attempts.
+type download struct {
+	c   *Client
+	ctx context.Context
+
+	// path is the API path of the file, and storage the URL it redirected
+	// to, once known.
+	path    string
+	storage *url.URL
+
+	w        io.WriterAt
+	offset   int64
+	total    int64
+	verifier *checksumVerifier
+	progress *progressTracker
+}
+
+// fetch downloads the file from the current offset until the end. If it
+// fails, it also reports whether it is worth resuming the download.
+func (d *download) fetch() (bool, error) {
+	resp, err := d.open()
+	if err != nil {
+		// Storage URLs are usually signed and may expire, so get a fresh
+		// one the next time.
+		d.storage = nil
+
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			// Resuming a file that is already complete
+			if apiErr.StatusCode == http.StatusRequestedRangeNotSatisfiable && d.offset > 0 {
+				return false, nil
+			}
+
+			return apiErr.StatusCode >= 500 || apiErr.StatusCode == 429 ||
+				apiErr.StatusCode == 403, err
+		}
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if err := d.position(resp); err != nil {
+		return false, err
+	}
+	d.progress.reset(d.offset, d.total)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, rerr := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err := d.w.WriteAt(buf[:n], d.offset); err != nil {
+				return false, err
+			}
+			if d.verifier != nil {
+				d.verifier.hash.Write(buf[:n])
+			}
+
+			d.offset += int64(n)
+			d.progress.add(int64(n))
+		}
+
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return true, rerr
+		}
+	}
+
+	if d.total >= 0 && d.offset != d.total {
+		return true, io.ErrUnexpectedEOF
+	}
+
+	return false, nil
+}
+
+// open requests the file from the current offset, resolving the storage
+// URL first if needed.
+func (d *download) open() (*http.Response, error) {
+	if d.storage == nil {
+		request, err := d.c.RequestContext(withoutRedirects(d.ctx), "GET", d.path, nil)
+		if err != nil {
+			return nil, err
+		}
+		d.setRange(request)
+
+		resp, err := d.c.send(request)
+		if err != nil {
+			return nil, err
+		}
+
+		switch resp.StatusCode {
+		case 301, 302, 303, 307, 308:
+		default:
+			// Atlas served the file itself
+			return checkResp(resp, nil)
+		}
+
+		location, err := resp.Location()
+		discardResp(resp)
+		if err != nil {
+			return nil, err
+		}
+		d.storage = location
+	}
+
+	// The storage backend is a third party, so it must not get the token.
+	storage := *d.storage
+	request, err := d.c.rawRequest(d.ctx, "GET", &storage, new(RequestOptions))
+	if err != nil {
+		return nil, err
+	}
+	d.setRange(request)
+
+	return checkResp(d.c.send(request))
+}
+
+// setRange asks for the part of the file after the current offset.
+func (d *download) setRange(request *http.Request) {
+	if d.offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", d.offset))
+	}
+}
+
+// position checks where in the file the response starts, restarting the
+// download if the server ignored the Range request, and records the total
+// size of the file.
+func (d *download) position(resp *http.Response) error {
+	if resp.StatusCode != http.StatusPartialContent {
+		if d.offset > 0 {
+			d.c.logger().Warnf("server doesn't support resuming, restarting download")
+			d.offset = 0
+			if d.verifier != nil {
+				d.verifier.hash.Reset()
+			}
+		}
+
+		d.total = resp.ContentLength
+		return nil
+	}
+
+	// Content-Range: bytes <start>-<end>/<total>
+	var start, total int64 = -1, -1
+	cr := strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes ")
+	if parts := strings.SplitN(cr, "/", 2); len(parts) == 2 {
+		if r := strings.SplitN(parts[0], "-", 2); len(r) == 2 {
+			if n, err := strconv.ParseInt(r[0], 10, 64); err == nil {
+				start = n
+			}
+		}
+		if n, err := strconv.ParseInt(parts[1], 10, 64); err == nil {
+			total = n
+		}
+	}
+
+	if start != d.offset {
+		return fmt.Errorf("client: unexpected Content-Range %q resuming at %d",
+			resp.Header.Get("Content-Range"), d.offset)
+	}
+
+	d.total = total
+	return nil
+}
+
+// checksumVerifier hashes data and compares it to an expected checksum.
+type checksumVerifier struct {
+	typ      string
+	expected string
+	hash     hash.Hash
+}
+
+// newChecksumVerifier returns a verifier for the checksum in the given
+// artifact metadata, or nil if there isn't one. The checksum must be hex of
+// the right length for its type, since anyone who can upload a version sets
+// it and the cache uses it as a file name.
+func newChecksumVerifier(metadata map[string]string) (*checksumVerifier, error) {
+	expected := strings.ToLower(metadata[MetadataChecksumKey])
+	if expected == "" {
+		return nil, nil
+	}
+
+	typ := strings.ToLower(metadata[MetadataChecksumTypeKey])
+	if typ == "" {
+		typ = "sha256"
+	}
+
+	var h hash.Hash
+	switch typ {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("client: unsupported checksum type %q", typ)
+	}
+
+	if _, err := hex.DecodeString(expected); err != nil || len(expected) != 2*h.Size() {
+		return nil, fmt.Errorf("client: malformed %s checksum %q", typ, expected)
+	}
+
+	return &checksumVerifier{typ: typ, expected: expected, hash: h}, nil
+}
+
+// verify compares the hash of the data so far to the expected checksum.
+func (v *checksumVerifier) verify() error {
+	actual := hex.EncodeToString(v.hash.Sum(nil))
+	if actual != v.expected {
+		return &ChecksumError{Type: v.typ, Expected: v.expected, Actual: actual}
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package atlas
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memWriterAt is an in-memory io.WriterAt.
+type memWriterAt struct {
+	buf []byte
+}
+
+func (m *memWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(m.buf) {
+		m.buf = append(m.buf, make([]byte, end-len(m.buf))...)
+	}
+	copy(m.buf[off:], p)
+	return len(p), nil
+}
+
+func testArtifactChecksum() string {
+	sum := sha256.Sum256(testArtifactFile)
+	return hex.EncodeToString(sum[:])
+}
+
+func testDownloadVersion(version int) *ArtifactVersion {
+	return &ArtifactVersion{
+		User:    "hashicorp",
+		Name:    "existing",
+		Type:    "vagrant-box",
+		Version: version,
+		File:    true,
+		Metadata: map[string]string{
+			MetadataChecksumKey: testArtifactChecksum(),
+		},
+	}
+}
+
+func TestDownloadArtifact(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Token = "a.atlasv1.b"
+
+	var last Progress
+	w := new(memWriterAt)
+	n, err := client.DownloadArtifact(testDownloadVersion(1), w, &DownloadArtifactOpts{
+		Progress: func(p Progress) { last = p },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != int64(len(testArtifactFile)) || !bytes.Equal(w.buf, testArtifactFile) {
+		t.Fatalf("bad download: %d bytes", n)
+	}
+	if last.Bytes != n || last.Total != n {
+		t.Fatalf("bad progress: %#v", last)
+	}
+}
+
+func TestDownloadArtifact_resume(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Token = "a.atlasv1.b"
+	client.RetryPolicy = &RetryPolicy{MaxRetries: 2, MinWait: time.Millisecond, MaxWait: time.Millisecond}
+
+	w := new(memWriterAt)
+	n, err := client.DownloadArtifact(testDownloadVersion(2), w, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != int64(len(testArtifactFile)) || !bytes.Equal(w.buf, testArtifactFile) {
+		t.Fatalf("bad download: %d bytes", n)
+	}
+	if server.attemptCount("/_storage/flaky-box") != 1 {
+		t.Fatal("expected the download to be interrupted")
+	}
+}
+
+func TestDownloadArtifact_checksumMismatch(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Token = "a.atlasv1.b"
+
+	av := testDownloadVersion(1)
+	av.Metadata[MetadataChecksumKey] = strings.Repeat("0", 64)
+
+	_, err = client.DownloadArtifact(av, new(memWriterAt), nil)
+
+	var ce *ChecksumError
+	if !errors.As(err, &ce) {
+		t.Fatalf("bad error: %#v", err)
+	}
+	if ce.Actual != testArtifactChecksum() {
+		t.Fatalf("bad checksum: %s", ce.Actual)
+	}
+}
+
+func TestDownloadArtifact_noFile(t *testing.T) {
+	client, err := NewClient("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	av := testDownloadVersion(1)
+	av.File = false
+	if _, err := client.DownloadArtifact(av, new(memWriterAt), nil); err == nil {
+		t.Fatal("expected error, but nothing was returned")
+	}
+}
+
+func TestDownloadArtifactToFile_resume(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Token = "a.atlasv1.b"
+
+	dir, err := ioutil.TempDir("", "atlas-go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Pretend an earlier download got part of the way
+	path := filepath.Join(dir, "box")
+	if err := ioutil.WriteFile(path, testArtifactFile[:1234], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := client.DownloadArtifactToFile(testDownloadVersion(1), path,
+		&DownloadArtifactOpts{Resume: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(testArtifactFile)) || !bytes.Equal(data, testArtifactFile) {
+		t.Fatalf("bad download: %d bytes", n)
+	}
+
+	// Resuming a complete download is a no-op
+	if _, err := client.DownloadArtifactToFile(testDownloadVersion(1), path,
+		&DownloadArtifactOpts{Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+}
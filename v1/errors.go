@@ -0,0 +1,151 @@
+package atlas
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrAuth is the error returned if a 401 is returned by an API request.
+var ErrAuth = fmt.Errorf("authentication failed")
+
+// ErrForbidden is the error returned if a 403 is returned by an API request.
+// Unlike ErrAuth, the token is valid but lacks permission for the resource.
+var ErrForbidden = fmt.Errorf("permission denied")
+
+// ErrNotFound is the error returned if a 404 is returned by an API request.
+var ErrNotFound = fmt.Errorf("resource not found")
+
+// ErrConflict is the error returned if a 409 is returned by an API request.
+var ErrConflict = fmt.Errorf("resource conflict")
+
+// ErrRateLimited is the error returned if a 429 is returned by an API
+// request.
+var ErrRateLimited = fmt.Errorf("rate limit exceeded")
+
+// ErrServer is the error returned if a 5xx is returned by an API request.
+var ErrServer = fmt.Errorf("server error")
+
+// RailsError represents an error that was returned from the Rails server.
+type RailsError struct {
+	Errors []string `json:"errors"`
+}
+
+// Error collects all of the errors in the RailsError and returns a comma-
+// separated list of the errors that were returned from the server.
+func (re *RailsError) Error() string {
+	return strings.Join(re.Errors, ", ")
+}
+
+// APIError is the error returned for any unsuccessful API response. It keeps
+// everything about the response that is useful for reporting or handling
+// the failure.
+//
+// APIError works with errors.Is for the sentinel errors above, so callers
+// can keep writing errors.Is(err, ErrNotFound). It also works with errors.As
+// for *RailsError when the server returned a list of errors.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+
+	// Method and Path identify the request that failed.
+	Method string
+	Path   string
+
+	// RequestID is the ID the server assigned to the request, if any. This
+	// is useful when reporting problems to the Atlas team.
+	RequestID string
+
+	// Errors is the list of errors parsed from a Rails error response.
+	Errors []string
+
+	// Header and Body are the raw response headers and body.
+	Header http.Header
+	Body   []byte
+}
+
+// Error returns a description of the failed request and the reason it
+// failed.
+func (e *APIError) Error() string {
+	reason := strings.Join(e.Errors, ", ")
+	if reason == "" {
+		if sentinel := e.sentinel(); sentinel != nil {
+			reason = sentinel.Error()
+		} else {
+			reason = http.StatusText(e.StatusCode)
+		}
+	}
+
+	msg := fmt.Sprintf("client: %s %s: %d %s", e.Method, e.Path, e.StatusCode, reason)
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(" (request id: %s)", e.RequestID)
+	}
+
+	return msg
+}
+
+// Is reports whether the error matches one of the sentinel errors for its
+// status code.
+func (e *APIError) Is(target error) bool {
+	return target != nil && e.sentinel() == target
+}
+
+// As sets target to the RailsError for this response if target is a
+// **RailsError and the server returned a list of errors.
+func (e *APIError) As(target interface{}) bool {
+	re, ok := target.(**RailsError)
+	if !ok || len(e.Errors) == 0 {
+		return false
+	}
+
+	*re = &RailsError{Errors: e.Errors}
+	return true
+}
+
+// sentinel returns the sentinel error for the status code, or nil if there
+// isn't one.
+func (e *APIError) sentinel() error {
+	switch {
+	case e.StatusCode == 401:
+		return ErrAuth
+	case e.StatusCode == 403:
+		return ErrForbidden
+	case e.StatusCode == 404:
+		return ErrNotFound
+	case e.StatusCode == 409:
+		return ErrConflict
+	case e.StatusCode == 429:
+		return ErrRateLimited
+	case e.StatusCode >= 500:
+		return ErrServer
+	default:
+		return nil
+	}
+}
+
+// newAPIError builds an APIError from an unsuccessful response and its
+// already-read body.
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("X-Request-Id"),
+		Header:     resp.Header,
+		Body:       body,
+	}
+
+	if resp.Request != nil {
+		e.Method = resp.Request.Method
+		e.Path = resp.Request.URL.Path
+	}
+
+	// Atlas returns a list of errors for most failures, but not all of
+	// them (and not proxies in front of it), so ignore anything we can't
+	// decode; the raw body is still available.
+	var re RailsError
+	if err := json.Unmarshal(body, &re); err == nil {
+		e.Errors = re.Errors
+	}
+
+	return e
+}
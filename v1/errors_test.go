@@ -0,0 +1,123 @@
+package atlas
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAPIError_statusCodes(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.RetryPolicy = nil
+
+	cases := []struct {
+		Code     int
+		Expected error
+	}{
+		{401, ErrAuth},
+		{403, ErrForbidden},
+		{404, ErrNotFound},
+		{409, ErrConflict},
+		{429, ErrRateLimited},
+		{500, ErrServer},
+		{503, ErrServer},
+		{418, nil},
+	}
+
+	sentinels := []error{
+		ErrAuth, ErrForbidden, ErrNotFound, ErrConflict, ErrRateLimited, ErrServer,
+	}
+
+	for _, tc := range cases {
+		path := fmt.Sprintf("/_status/%d", tc.Code)
+		request, err := client.Request("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = client.do(request)
+		if err == nil {
+			t.Fatalf("%d: expected error, but nothing was returned", tc.Code)
+		}
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("%d: bad error: %#v", tc.Code, err)
+		}
+		if apiErr.StatusCode != tc.Code {
+			t.Fatalf("%d: bad status code: %d", tc.Code, apiErr.StatusCode)
+		}
+		if apiErr.Method != "GET" || apiErr.Path != path {
+			t.Fatalf("%d: bad request: %s %s", tc.Code, apiErr.Method, apiErr.Path)
+		}
+
+		for _, sentinel := range sentinels {
+			if errors.Is(err, sentinel) != (sentinel == tc.Expected) {
+				t.Fatalf("%d: unexpected match for %q", tc.Code, sentinel)
+			}
+		}
+	}
+}
+
+func TestAPIError_railsError(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request, err := client.Request("GET", "/_rails-error", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.do(request)
+	if err == nil {
+		t.Fatal("expected error, but nothing was returned")
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("bad error: %#v", err)
+	}
+
+	expected := []string{"this is an error", "this is another error"}
+	if !reflect.DeepEqual(apiErr.Errors, expected) {
+		t.Fatalf("expected %q to be %q", apiErr.Errors, expected)
+	}
+	if apiErr.RequestID != "abc123" {
+		t.Fatalf("bad request id: %q", apiErr.RequestID)
+	}
+	if !strings.Contains(string(apiErr.Body), "this is an error") {
+		t.Fatalf("bad body: %q", apiErr.Body)
+	}
+
+	msg := "client: GET /_rails-error: 422 this is an error, this is another error (request id: abc123)"
+	if err.Error() != msg {
+		t.Fatalf("expected %q to be %q", err.Error(), msg)
+	}
+}
+
+func TestAPIError_noRailsError(t *testing.T) {
+	err := &APIError{StatusCode: 404, Method: "GET", Path: "/foo"}
+
+	var re *RailsError
+	if errors.As(err, &re) {
+		t.Fatalf("should not be a RailsError: %#v", re)
+	}
+
+	expected := "client: GET /foo: 404 resource not found"
+	if err.Error() != expected {
+		t.Fatalf("expected %q to be %q", err.Error(), expected)
+	}
+}
@@ -0,0 +1,239 @@
+package atlas
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Logger is the interface used by the Client to log what it is doing. Set
+// Client.Logger to receive the messages; by default nothing is logged.
+//
+// Messages are redacted before they reach the Logger: the client's token,
+// upload tokens and the values of sensitive BuildVars are masked. Response
+// bodies logged at debug level have their token fields and sensitive values
+// masked as well, and JSON bodies that can't be redacted aren't logged.
+// Values shorter than six characters are only masked in response bodies,
+// since masking them everywhere would garble unrelated text.
+type Logger interface {
+	Debugf(format string, v ...interface{})
+	Infof(format string, v ...interface{})
+	Warnf(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+}
+
+// DebugEnabler can be implemented by a Logger to report whether it logs
+// debug messages. Response bodies are only read for logging when debug
+// messages are enabled; a Logger that doesn't implement DebugEnabler is
+// assumed to log them.
+type DebugEnabler interface {
+	DebugEnabled() bool
+}
+
+// NewStdLogger returns a Logger that writes to the given standard library
+// logger, prefixing each message with its level ("[DEBUG]", "[INFO]",
+// "[WARN]" or "[ERR]") so it can be filtered by tools such as logutils. If
+// l is nil, the standard logger of the log package is used.
+func NewStdLogger(l *log.Logger) Logger {
+	if l == nil {
+		l = log.New(log.Writer(), log.Prefix(), log.Flags())
+	}
+
+	return &stdLogger{l: l}
+}
+
+type stdLogger struct {
+	l *log.Logger
+}
+
+func (s *stdLogger) Debugf(format string, v ...interface{}) {
+	s.l.Printf("[DEBUG] "+format, v...)
+}
+
+func (s *stdLogger) Infof(format string, v ...interface{}) {
+	s.l.Printf("[INFO] "+format, v...)
+}
+
+func (s *stdLogger) Warnf(format string, v ...interface{}) {
+	s.l.Printf("[WARN] "+format, v...)
+}
+
+func (s *stdLogger) Errorf(format string, v ...interface{}) {
+	s.l.Printf("[ERR] "+format, v...)
+}
+
+// nopLogger is the default Logger, which discards everything.
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Infof(string, ...interface{})  {}
+func (nopLogger) Warnf(string, ...interface{})  {}
+func (nopLogger) Errorf(string, ...interface{}) {}
+
+// redactingLogger formats messages and masks any known secrets in them
+// before passing them on to the wrapped Logger.
+type redactingLogger struct {
+	l Logger
+	c *Client
+}
+
+func (r *redactingLogger) Debugf(format string, v ...interface{}) {
+	r.l.Debugf("%s", r.c.redact(fmt.Sprintf(format, v...)))
+}
+
+func (r *redactingLogger) Infof(format string, v ...interface{}) {
+	r.l.Infof("%s", r.c.redact(fmt.Sprintf(format, v...)))
+}
+
+func (r *redactingLogger) Warnf(format string, v ...interface{}) {
+	r.l.Warnf("%s", r.c.redact(fmt.Sprintf(format, v...)))
+}
+
+func (r *redactingLogger) Errorf(format string, v ...interface{}) {
+	r.l.Errorf("%s", r.c.redact(fmt.Sprintf(format, v...)))
+}
+
+// logger returns the Logger the client should log to. All client code
+// logs through this so that secrets are always redacted.
+func (c *Client) logger() Logger {
+	if c.Logger == nil {
+		return nopLogger{}
+	}
+
+	return &redactingLogger{l: c.Logger, c: c}
+}
+
+// debugEnabled reports whether the client's Logger logs debug messages.
+func (c *Client) debugEnabled() bool {
+	if c.Logger == nil {
+		return false
+	}
+
+	if d, ok := c.Logger.(DebugEnabler); ok {
+		return d.DebugEnabled()
+	}
+
+	return true
+}
+
+const (
+	// minSecretLength is the length below which values aren't masked by
+	// substring, since they would mask unrelated text in log messages.
+	minSecretLength = 6
+
+	// maxSecrets is the number of registered secrets a client keeps. When
+	// more are registered, the oldest are forgotten.
+	maxSecrets = 128
+)
+
+// secrets holds the values that must never be logged, oldest first.
+type secrets struct {
+	sync.RWMutex
+	values []string
+}
+
+// addSecret registers a value that must be masked in any log output.
+// Values shorter than minSecretLength are ignored.
+func (c *Client) addSecret(s string) {
+	if len(s) < minSecretLength {
+		return
+	}
+
+	c.secrets.Lock()
+	defer c.secrets.Unlock()
+	for i, v := range c.secrets.values {
+		if v == s {
+			// Move it to the end, so it is forgotten last
+			c.secrets.values = append(c.secrets.values[:i], c.secrets.values[i+1:]...)
+			break
+		}
+	}
+	if len(c.secrets.values) >= maxSecrets {
+		c.secrets.values = c.secrets.values[1:]
+	}
+	c.secrets.values = append(c.secrets.values, s)
+}
+
+// redact masks the client token and every registered secret in s.
+func (c *Client) redact(s string) string {
+	if len(c.Token) >= minSecretLength {
+		s = strings.Replace(s, c.Token, maskString(c.Token), -1)
+	}
+
+	c.secrets.RLock()
+	defer c.secrets.RUnlock()
+	for _, secret := range c.secrets.values {
+		s = strings.Replace(s, secret, maskString(secret), -1)
+	}
+
+	return s
+}
+
+// secretFields are the JSON fields of response bodies that always hold
+// secrets, such as the token returned by Login and upload tokens.
+var secretFields = map[string]bool{
+	"token":        true,
+	"upload_token": true,
+	"access_token": true,
+}
+
+// redactBody returns a response body for logging, with the secrets in it
+// masked and registered with addSecret. JSON bodies are decoded to find the
+// secret fields and the values of sensitive variables; if a JSON body can't
+// be decoded, for example because it was truncated, ok is false and the body
+// must not be logged.
+func (c *Client) redactBody(body []byte, truncated bool) (string, bool) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return c.redact(string(body)), true
+	}
+
+	if truncated {
+		return "", false
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(trimmed, &v); err != nil {
+		return "", false
+	}
+
+	redacted, err := json.Marshal(c.redactJSON(v))
+	if err != nil {
+		return "", false
+	}
+
+	return string(redacted), true
+}
+
+// redactJSON masks the secret fields, and the values of objects marked as
+// sensitive, in a decoded JSON value.
+func (c *Client) redactJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		sensitive, _ := v["sensitive"].(bool)
+		for k, e := range v {
+			s, isString := e.(string)
+			switch {
+			case isString && secretFields[k]:
+				c.addSecret(s)
+				v[k] = maskString(s)
+			case isString && sensitive && k == "value":
+				if s != MaskedValue {
+					c.addSecret(s)
+				}
+				v[k] = MaskedValue
+			default:
+				v[k] = c.redactJSON(e)
+			}
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = c.redactJSON(e)
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,228 @@
+package atlas
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testLogger struct {
+	sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Debugf(format string, v ...interface{}) { l.add("DEBUG", format, v) }
+func (l *testLogger) Infof(format string, v ...interface{})  { l.add("INFO", format, v) }
+func (l *testLogger) Warnf(format string, v ...interface{})  { l.add("WARN", format, v) }
+func (l *testLogger) Errorf(format string, v ...interface{}) { l.add("ERR", format, v) }
+
+func (l *testLogger) add(level, format string, v []interface{}) {
+	l.Lock()
+	defer l.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf("[%s] ", level)+fmt.Sprintf(format, v...))
+}
+
+func (l *testLogger) String() string {
+	l.Lock()
+	defer l.Unlock()
+	return strings.Join(l.lines, "\n")
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0))
+	l.Debugf("one %d", 1)
+	l.Infof("two")
+	l.Warnf("three")
+	l.Errorf("four")
+
+	expected := "[DEBUG] one 1\n[INFO] two\n[WARN] three\n[ERR] four\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q to be %q", buf.String(), expected)
+	}
+}
+
+func TestLogger_redactsToken(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := new(testLogger)
+	client.Logger = l
+	client.Token = "a.atlasv1.b"
+
+	request, err := client.Request("GET", "/_test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The test handler echoes the headers, including the token, back in
+	// the response body.
+	if _, err := client.do(request); err != nil {
+		t.Fatal(err)
+	}
+
+	output := l.String()
+	if !strings.Contains(output, "[DEBUG] response:") {
+		t.Fatalf("expected the response to be logged:\n%s", output)
+	}
+	if strings.Contains(output, client.Token) {
+		t.Fatalf("token was logged:\n%s", output)
+	}
+}
+
+func TestLogger_redactsSecrets(t *testing.T) {
+	client, err := NewClient("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := new(testLogger)
+	client.Logger = l
+	client.addSecret("sup3rs3cret")
+
+	client.logger().Infof("value is %s", "sup3rs3cret")
+
+	expected := "[INFO] value is sup*** (masked)"
+	if l.String() != expected {
+		t.Fatalf("expected %q to be %q", l.String(), expected)
+	}
+}
+
+func TestLogger_shortSecrets(t *testing.T) {
+	client, err := NewClient("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Token = "ab"
+
+	l := new(testLogger)
+	client.Logger = l
+	client.addSecret("1")
+
+	// Values this short would mask unrelated text
+	client.logger().Infof("uploaded 1 file to about:blank")
+
+	expected := "[INFO] uploaded 1 file to about:blank"
+	if l.String() != expected {
+		t.Fatalf("expected %q to be %q", l.String(), expected)
+	}
+}
+
+func TestLogger_secretsBounded(t *testing.T) {
+	client, err := NewClient("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2*maxSecrets; i++ {
+		client.addSecret(fmt.Sprintf("secret-%d", i))
+	}
+	client.addSecret(fmt.Sprintf("secret-%d", 2*maxSecrets-1))
+
+	if n := len(client.secrets.values); n != maxSecrets {
+		t.Fatalf("expected %d secrets, got %d", maxSecrets, n)
+	}
+
+	// The most recent ones are kept
+	latest := fmt.Sprintf("secret-%d", 2*maxSecrets-1)
+	if s := client.redact(latest); strings.Contains(s, latest) {
+		t.Fatalf("not redacted: %q", s)
+	}
+}
+
+func TestLogger_redactsLoginToken(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := new(testLogger)
+	client.Logger = l
+
+	token, err := client.Login("sethloves", "bacon")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := l.String()
+	if !strings.Contains(output, `{"token":"pX4*** (masked)"}`) {
+		t.Fatalf("expected the masked response to be logged:\n%s", output)
+	}
+	if strings.Contains(output, token) {
+		t.Fatalf("token was logged:\n%s", output)
+	}
+}
+
+func TestLogger_redactsSensitiveValues(t *testing.T) {
+	client, err := NewClient("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"vars": [{"key": "a", "value": "one"}, {"key": "b", "value": "two", "sensitive": true}],` +
+		` "upload_token": "abcdef"}`
+	logged, ok := client.redactBody([]byte(body), false)
+	if !ok {
+		t.Fatal("expected the body to be redacted")
+	}
+
+	expected := `{"upload_token":"abc*** (masked)","vars":[{"key":"a","value":"one"},` +
+		`{"key":"b","sensitive":true,"value":"*** (masked)"}]}`
+	if logged != expected {
+		t.Fatalf("expected %q to be %q", logged, expected)
+	}
+}
+
+func TestLogger_truncatedJSON(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := new(testLogger)
+	client.Logger = l
+
+	request, err := client.Request("GET", "/_large-json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := client.do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	discardResp(response)
+
+	// A truncated JSON body can't be redacted, so it isn't logged at all
+	output := l.String()
+	if strings.Contains(output, "s3cr3t-token") {
+		t.Fatalf("token was logged:\n%s", output)
+	}
+	if !strings.Contains(output, "not logged") {
+		t.Fatalf("expected the body to be skipped:\n%s", output)
+	}
+}
+
+func TestLogger_nil(t *testing.T) {
+	client, err := NewClient("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Logger = nil
+	client.logger().Infof("nothing should happen")
+}
@@ -0,0 +1,57 @@
+package atlas
+
+import (
+	"context"
+	"net/http"
+)
+
+// RoundTripFunc sends a single HTTP request and returns its response.
+type RoundTripFunc func(*http.Request) (*http.Response, error)
+
+// Middleware wraps the sending of every request the Client makes, including
+// file uploads and each retry attempt. A Middleware can inspect or modify
+// the request before calling next, return its own response or error instead
+// of calling next, and observe or replace the response and error that next
+// returns.
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// Use appends middleware to the client. Middleware runs in the order it was
+// added: the first one added sees the request first and the response last.
+// Middleware must be added before the client is used concurrently.
+func (c *Client) Use(mw ...Middleware) {
+	c.Middleware = append(c.Middleware, mw...)
+}
+
+// roundTrip returns the client's HTTPClient wrapped in its middleware.
+func (c *Client) roundTrip() RoundTripFunc {
+	rt := RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if noRedirects(req.Context()) {
+			hc := *c.HTTPClient
+			hc.CheckRedirect = func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			}
+			return hc.Do(req)
+		}
+
+		return c.HTTPClient.Do(req)
+	})
+	for i := len(c.Middleware) - 1; i >= 0; i-- {
+		rt = c.Middleware[i](rt)
+	}
+
+	return rt
+}
+
+type noRedirectsKey struct{}
+
+// withoutRedirects returns a context that makes the client return redirect
+// responses instead of following them.
+func withoutRedirects(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRedirectsKey{}, true)
+}
+
+// noRedirects reports whether the context was created by withoutRedirects.
+func noRedirects(ctx context.Context) bool {
+	v, _ := ctx.Value(noRedirectsKey{}).(bool)
+	return v
+}
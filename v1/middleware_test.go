@@ -0,0 +1,147 @@
+package atlas
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware_order(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next RoundTripFunc) RoundTripFunc {
+			return func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, name+" request")
+				resp, err := next(req)
+				calls = append(calls, fmt.Sprintf("%s response %d", name, resp.StatusCode))
+				return resp, err
+			}
+		}
+	}
+	client.Use(record("one"), record("two"))
+
+	request, err := client.Request("GET", "/_status/200", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.do(request); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"one request",
+		"two request",
+		"two response 200",
+		"one response 200",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("expected %q to be %q", calls, expected)
+	}
+}
+
+func TestMiddleware_modifiesRequest(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.Use(func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			req.Header.Set("X-Org", "hashicorp")
+			return next(req)
+		}
+	})
+
+	request, err := client.Request("GET", "/_test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &clientTestResp{}
+	if err := decodeJSON(response, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Header.Get("X-Org") != "hashicorp" {
+		t.Fatalf("bad header: %q", decoded.Header.Get("X-Org"))
+	}
+}
+
+func TestMiddleware_shortCircuit(t *testing.T) {
+	client, err := NewClient("http://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.RetryPolicy = nil
+
+	client.Use(func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 403,
+				Status:     "403 Forbidden",
+				Header:     make(http.Header),
+			}, nil
+		}
+	})
+
+	_, err = client.Artifact("hashicorp", "existing")
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("bad error: %#v", err)
+	}
+	if !strings.Contains(err.Error(), "/api/v1/artifacts/hashicorp/existing") {
+		t.Fatalf("bad error: %s", err)
+	}
+}
+
+func TestMiddleware_putFile(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var methods []string
+	client.Use(func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			methods = append(methods, req.Method)
+			return next(req)
+		}
+	})
+
+	_, err = client.UploadArtifact(&UploadArtifactOpts{
+		User:     "hashicorp",
+		Name:     "existing",
+		Type:     "amazon-ami",
+		File:     strings.NewReader("hello"),
+		FileSize: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The version is created with the file's checksum, then the file is
+	// uploaded
+	expected := []string{"POST", "PUT"}
+	if !reflect.DeepEqual(methods, expected) {
+		t.Fatalf("expected %q to be %q", methods, expected)
+	}
+}
@@ -0,0 +1,413 @@
+package atlas
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPageSize is the number of items requested per page when
+// ListOptions.PerPage isn't set.
+const DefaultPageSize = 100
+
+// ErrStopIteration can be returned, or wrapped, by the function given to a
+// ForEach method to stop iterating early. ForEach then returns nil.
+var ErrStopIteration = fmt.Errorf("stop iteration")
+
+// ListOptions are the paging options shared by the methods that list
+// things. Pages are fetched lazily, as the results are iterated over.
+type ListOptions struct {
+	// Page is the page to start from, starting at 1. Zero is the same as 1.
+	Page int
+
+	// PerPage is the number of items to request per page. If it is zero,
+	// DefaultPageSize is used.
+	PerPage int
+}
+
+// pager fetches the pages of a list endpoint one at a time.
+//
+// The server is asked for a page with the "page" and "per_page" query
+// parameters. There are more pages if the response has a Link header with
+// a rel="next" link, or, without a Link header, if the page was full. A
+// server that ignores the "page" parameter would return the same full page
+// forever, so a page that is the same as the one before it ends the list,
+// with a warning.
+type pager struct {
+	c      *Client
+	ctx    context.Context
+	path   string
+	params map[string]string
+
+	page    int
+	perPage int
+	done    bool
+
+	// lastSum is the SHA-256 checksum of the body of the last page.
+	lastSum []byte
+
+	// cache, if set, caches the pages.
+	cache *Cache
+
+	// decode decodes the items of a page.
+	decode func(*http.Response) ([]interface{}, error)
+}
+
+func newPager(ctx context.Context, c *Client, path string, params map[string]string,
+	opts ListOptions, decode func(*http.Response) ([]interface{}, error)) *pager {
+	page := opts.Page
+	if page < 1 {
+		page = 1
+	}
+
+	perPage := opts.PerPage
+	if perPage <= 0 {
+		perPage = DefaultPageSize
+	}
+
+	return &pager{
+		c:       c,
+		ctx:     ctx,
+		path:    path,
+		params:  params,
+		page:    page,
+		perPage: perPage,
+		decode:  decode,
+	}
+}
+
+// fetch requests the next page and returns its items.
+func (p *pager) fetch() ([]interface{}, error) {
+	params := make(map[string]string, len(p.params)+2)
+	for k, v := range p.params {
+		params[k] = v
+	}
+	params["page"] = strconv.Itoa(p.page)
+	params["per_page"] = strconv.Itoa(p.perPage)
+
+	p.c.logger().Debugf("fetching page %d of %s", p.page, p.path)
+
+	request, err := p.c.RequestContext(p.ctx, "GET", p.path, &RequestOptions{
+		Params: params,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := p.send(request)
+	if err != nil {
+		return nil, err
+	}
+
+	links, hasLinks := response.Header["Link"]
+
+	hash := sha256.New()
+	response.Body = &multiReadCloser{
+		Reader: io.TeeReader(response.Body, hash),
+		Closer: response.Body,
+	}
+
+	items, err := p.decode(response)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := hash.Sum(nil)
+	if len(items) > 0 && bytes.Equal(sum, p.lastSum) {
+		p.c.logger().Warnf("page %d of %s is the same as page %d, the server seems "+
+			"to ignore the page parameter; the results may be incomplete",
+			p.page, p.path, p.page-1)
+		p.done = true
+		return nil, nil
+	}
+	p.lastSum = sum
+
+	p.page++
+	switch {
+	case len(items) == 0:
+		p.done = true
+	case hasLinks:
+		p.done = !hasNextLink(links)
+	default:
+		p.done = len(items) < p.perPage
+	}
+
+	return items, nil
+}
+
+// send sends the request for a page, using the cache if there is one.
+func (p *pager) send(request *http.Request) (*http.Response, error) {
+	if p.cache == nil {
+		return p.c.do(request)
+	}
+
+	key := searchKey(p.c.Token, request)
+	cached := p.cache.lookup(key)
+	if cached != nil && p.cache.fresh(cached) {
+		p.c.logger().Debugf("using cached page %d of %s", p.page, p.path)
+		return cached.response(), nil
+	}
+	if cached != nil && cached.ETag != "" {
+		request.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	response, err := p.c.do(request)
+
+	var apiErr *APIError
+	if cached != nil && errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotModified {
+		p.c.logger().Debugf("cached page %d of %s is still valid", p.page, p.path)
+		cached.Stored = time.Now()
+		err = nil
+	} else if err == nil {
+		defer response.Body.Close()
+
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		cached = &cachedResponse{
+			URL:    request.URL.String(),
+			ETag:   response.Header.Get("ETag"),
+			Link:   response.Header["Link"],
+			Stored: time.Now(),
+			Body:   body,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.cache.store(key, cached); err != nil {
+		p.c.logger().Warnf("error caching page %d of %s: %s", p.page, p.path, err)
+	}
+
+	return cached.response(), nil
+}
+
+// hasNextLink reports whether the given Link headers have a rel="next" link.
+func hasNextLink(links []string) bool {
+	for _, header := range links {
+		for _, link := range strings.Split(header, ",") {
+			for _, param := range strings.Split(link, ";")[1:] {
+				param = strings.Replace(strings.TrimSpace(param), " ", "", -1)
+				if param == `rel="next"` || param == "rel=next" {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// iterator is what the typed iterators share: it fetches the items of a
+// list one page at a time, as Next reaches them.
+type iterator struct {
+	pager *pager
+	buf   []interface{}
+	cur   interface{}
+	err   error
+}
+
+// Next advances to the next item, fetching the next page if needed. It
+// returns false when there are no more, or an error occurred.
+func (it *iterator) Next() bool {
+	for len(it.buf) == 0 {
+		if it.err != nil || it.pager.done {
+			it.cur = nil
+			return false
+		}
+		it.buf, it.err = it.pager.fetch()
+	}
+
+	it.cur, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *iterator) Err() error {
+	return it.err
+}
+
+// forEach calls fn for each remaining item. It stops at the first error,
+// which is returned, unless it is ErrStopIteration.
+func (it *iterator) forEach(fn func(interface{}) error) error {
+	for it.Next() {
+		if err := fn(it.cur); err != nil {
+			if errors.Is(err, ErrStopIteration) {
+				return nil
+			}
+			return err
+		}
+	}
+
+	return it.Err()
+}
+
+// ArtifactVersionIterator iterates over a list of ArtifactVersions, fetching
+// pages as needed. Use it like a bufio.Scanner:
+//
+//	it := client.ArtifactSearchIter(opts)
+//	for it.Next() {
+//		v := it.Value()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// Next advances to the next ArtifactVersion and returns false when there are
+// no more, or an error occurred. Err returns the error that stopped the
+// iteration, if any.
+type ArtifactVersionIterator struct {
+	*iterator
+}
+
+// Value returns the current ArtifactVersion.
+func (it *ArtifactVersionIterator) Value() *ArtifactVersion {
+	v, _ := it.cur.(*ArtifactVersion)
+	return v
+}
+
+// ForEach calls fn for each remaining ArtifactVersion. It stops at the
+// first error, which is returned, unless it is ErrStopIteration.
+func (it *ArtifactVersionIterator) ForEach(fn func(*ArtifactVersion) error) error {
+	return it.forEach(func(v interface{}) error { return fn(v.(*ArtifactVersion)) })
+}
+
+// All returns all the remaining ArtifactVersions.
+func (it *ArtifactVersionIterator) All() ([]*ArtifactVersion, error) {
+	var result []*ArtifactVersion
+	err := it.forEach(func(v interface{}) error {
+		result = append(result, v.(*ArtifactVersion))
+		return nil
+	})
+
+	return result, err
+}
+
+// AppVersionIterator iterates over a list of AppVersions, fetching pages as
+// needed. It is used like ArtifactVersionIterator.
+type AppVersionIterator struct {
+	*iterator
+}
+
+// Value returns the current AppVersion.
+func (it *AppVersionIterator) Value() *AppVersion {
+	v, _ := it.cur.(*AppVersion)
+	return v
+}
+
+// ForEach calls fn for each remaining AppVersion, like
+// ArtifactVersionIterator.ForEach.
+func (it *AppVersionIterator) ForEach(fn func(*AppVersion) error) error {
+	return it.forEach(func(v interface{}) error { return fn(v.(*AppVersion)) })
+}
+
+// All returns all the remaining AppVersions.
+func (it *AppVersionIterator) All() ([]*AppVersion, error) {
+	var result []*AppVersion
+	err := it.forEach(func(v interface{}) error {
+		result = append(result, v.(*AppVersion))
+		return nil
+	})
+
+	return result, err
+}
+
+// BuildConfigVersionIterator iterates over a list of BuildConfigVersions,
+// fetching pages as needed. It is used like ArtifactVersionIterator.
+type BuildConfigVersionIterator struct {
+	*iterator
+}
+
+// Value returns the current BuildConfigVersion.
+func (it *BuildConfigVersionIterator) Value() *BuildConfigVersion {
+	v, _ := it.cur.(*BuildConfigVersion)
+	return v
+}
+
+// ForEach calls fn for each remaining BuildConfigVersion, like
+// ArtifactVersionIterator.ForEach.
+func (it *BuildConfigVersionIterator) ForEach(fn func(*BuildConfigVersion) error) error {
+	return it.forEach(func(v interface{}) error { return fn(v.(*BuildConfigVersion)) })
+}
+
+// All returns all the remaining BuildConfigVersions.
+func (it *BuildConfigVersionIterator) All() ([]*BuildConfigVersion, error) {
+	var result []*BuildConfigVersion
+	err := it.forEach(func(v interface{}) error {
+		result = append(result, v.(*BuildConfigVersion))
+		return nil
+	})
+
+	return result, err
+}
+
+// BuildIterator iterates over a list of Builds, fetching pages as needed. It
+// is used like ArtifactVersionIterator.
+type BuildIterator struct {
+	*iterator
+}
+
+// Value returns the current Build.
+func (it *BuildIterator) Value() *Build {
+	v, _ := it.cur.(*Build)
+	return v
+}
+
+// ForEach calls fn for each remaining Build, like
+// ArtifactVersionIterator.ForEach.
+func (it *BuildIterator) ForEach(fn func(*Build) error) error {
+	return it.forEach(func(v interface{}) error { return fn(v.(*Build)) })
+}
+
+// All returns all the remaining Builds.
+func (it *BuildIterator) All() ([]*Build, error) {
+	var result []*Build
+	err := it.forEach(func(v interface{}) error {
+		result = append(result, v.(*Build))
+		return nil
+	})
+
+	return result, err
+}
+
+// TerraformConfigVersionIterator iterates over a list of
+// TerraformConfigVersions, fetching pages as needed. It is used like
+// ArtifactVersionIterator.
+type TerraformConfigVersionIterator struct {
+	*iterator
+}
+
+// Value returns the current TerraformConfigVersion.
+func (it *TerraformConfigVersionIterator) Value() *TerraformConfigVersion {
+	v, _ := it.cur.(*TerraformConfigVersion)
+	return v
+}
+
+// ForEach calls fn for each remaining TerraformConfigVersion, like
+// ArtifactVersionIterator.ForEach.
+func (it *TerraformConfigVersionIterator) ForEach(fn func(*TerraformConfigVersion) error) error {
+	return it.forEach(func(v interface{}) error { return fn(v.(*TerraformConfigVersion)) })
+}
+
+// All returns all the remaining TerraformConfigVersions.
+func (it *TerraformConfigVersionIterator) All() ([]*TerraformConfigVersion, error) {
+	var result []*TerraformConfigVersion
+	err := it.forEach(func(v interface{}) error {
+		result = append(result, v.(*TerraformConfigVersion))
+		return nil
+	})
+
+	return result, err
+}
@@ -0,0 +1,178 @@
+package atlas
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func testVersionNumbers(versions []*ArtifactVersion) []int {
+	var result []int
+	for _, v := range versions {
+		result = append(result, v.Version)
+	}
+	return result
+}
+
+func TestArtifactSearch_pages(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"paged", "paged-nolink"} {
+		vs, err := client.ArtifactSearch(&ArtifactSearchOpts{
+			User:        "hashicorp",
+			Name:        name,
+			Type:        "amazon-ami",
+			ListOptions: ListOptions{PerPage: 2},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []int{1, 2, 3, 4, 5}
+		if actual := testVersionNumbers(vs); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("%s: bad: %#v", name, actual)
+		}
+	}
+
+	// The last page is known from the Link header, or from being short
+	if n := server.attemptCount("/api/v1/artifacts/hashicorp/paged/amazon-ami/search"); n != 3 {
+		t.Fatalf("expected 3 requests, got %d", n)
+	}
+	if n := server.attemptCount("/api/v1/artifacts/hashicorp/paged-nolink/amazon-ami/search"); n != 3 {
+		t.Fatalf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestArtifactSearch_pageIgnored(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &ArtifactSearchOpts{
+		User:        "hashicorp",
+		Name:        "unpaged",
+		Type:        "amazon.ami",
+		ListOptions: ListOptions{PerPage: 2},
+	}
+
+	// The first page is all there is
+	vs, err := client.ArtifactSearch(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 2 || vs[0].Version != 1 || vs[1].Version != 2 {
+		t.Fatalf("bad: %#v", vs)
+	}
+
+	// The second page gives it away
+	path := "/api/v1/artifacts/hashicorp/unpaged/amazon.ami/search"
+	if n := server.attemptCount(path); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+
+	ami, latest, err := client.ResolveAMI(opts, "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ami != "ami-2" || latest.Version != 2 {
+		t.Fatalf("bad: %s %#v", ami, latest)
+	}
+}
+
+func TestArtifactSearch_startPage(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vs, err := client.ArtifactSearch(&ArtifactSearchOpts{
+		User:        "hashicorp",
+		Name:        "paged",
+		Type:        "amazon-ami",
+		ListOptions: ListOptions{Page: 2, PerPage: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []int{3, 4, 5}
+	if actual := testVersionNumbers(vs); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestArtifactSearchIter_lazy(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	it := client.ArtifactSearchIter(&ArtifactSearchOpts{
+		User:        "hashicorp",
+		Name:        "paged",
+		Type:        "amazon-ami",
+		ListOptions: ListOptions{PerPage: 2},
+	})
+
+	path := "/api/v1/artifacts/hashicorp/paged/amazon-ami/search"
+	if n := server.attemptCount(path); n != 0 {
+		t.Fatalf("expected no requests, got %d", n)
+	}
+
+	var seen []int
+	err = it.ForEach(func(v *ArtifactVersion) error {
+		seen = append(seen, v.Version)
+		if v.Version == 3 {
+			return fmt.Errorf("found it: %w", ErrStopIteration)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(seen, []int{1, 2, 3}) {
+		t.Fatalf("bad: %#v", seen)
+	}
+	if n := server.attemptCount(path); n != 2 {
+		t.Fatalf("expected 2 requests, got %d", n)
+	}
+}
+
+func TestArtifactSearchIter_error(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	it := client.ArtifactSearchIter(&ArtifactSearchOpts{
+		User: "hashicorp",
+		Name: "missing",
+		Type: "amazon-ami",
+	})
+	if it.Next() {
+		t.Fatal("expected no versions")
+	}
+	if it.Err() == nil {
+		t.Fatal("expected error, but nothing was returned")
+	}
+}
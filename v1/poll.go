@@ -0,0 +1,189 @@
+package atlas
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"time"
+)
+
+// DefaultPollInterval is the time between polls used when PollOptions
+// doesn't set one.
+const DefaultPollInterval = 5 * time.Second
+
+// PollOptions configures how helpers such as WaitForBuild and BuildLog poll
+// the server while waiting for something to finish.
+type PollOptions struct {
+	// Interval is the time between polls. If zero, DefaultPollInterval is
+	// used.
+	Interval time.Duration
+
+	// Timeout is how long to keep polling before giving up. If zero, polling
+	// only stops when the context is done. Giving up returns an error that
+	// matches context.DeadlineExceeded (see errors.Is).
+	Timeout time.Duration
+}
+
+// interval returns the time between polls.
+func (o *PollOptions) interval() time.Duration {
+	if o == nil || o.Interval <= 0 {
+		return DefaultPollInterval
+	}
+
+	return o.Interval
+}
+
+// context returns a context that is done when the timeout, if any, expires.
+// The returned function must be called to release its resources.
+func (o *PollOptions) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o == nil || o.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, o.Timeout)
+}
+
+// poll calls fn until it reports that it is done or returns an error,
+// waiting for the poll interval between calls.
+func poll(ctx context.Context, opts *PollOptions, fn func(context.Context) (bool, error)) error {
+	ctx, cancel := opts.context(ctx)
+	defer cancel()
+
+	for {
+		done, err := fn(ctx)
+		if err != nil || done {
+			return err
+		}
+
+		if err := sleepContext(ctx, opts.interval()); err != nil {
+			return err
+		}
+	}
+}
+
+// sleepContext waits for the given duration, or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// followLog returns an io.ReadCloser that follows the log at the given API
+// path. The log is fetched from the offset read so far, and when there is
+// nothing new, done is called to check whether the log is complete before
+// waiting for the poll interval.
+func (c *Client) followLog(ctx context.Context, path string, opts *PollOptions,
+	done func(context.Context) (bool, error)) io.ReadCloser {
+	l := &logFollower{
+		c:        c,
+		path:     path,
+		done:     done,
+		interval: opts.interval(),
+	}
+	l.ctx, l.cancel = opts.context(ctx)
+
+	return l
+}
+
+// logFollower is the io.ReadCloser returned by followLog.
+type logFollower struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	c        *Client
+	path     string
+	done     func(context.Context) (bool, error)
+	interval time.Duration
+
+	// offset is how much of the log was fetched so far, and buf is what
+	// was fetched but not read yet.
+	offset int64
+	buf    []byte
+
+	// finished is set once the log is known to be complete; it is fetched
+	// once more after that, since output may have been written between the
+	// last fetch and the check.
+	finished bool
+	err      error
+}
+
+func (l *logFollower) Read(p []byte) (int, error) {
+	for len(l.buf) == 0 {
+		if l.err != nil {
+			return 0, l.err
+		}
+
+		l.err = l.next()
+		if l.err != nil {
+			l.cancel()
+		}
+	}
+
+	n := copy(p, l.buf)
+	l.buf = l.buf[n:]
+	return n, nil
+}
+
+// Close stops following the log. It may be called while a Read is blocked,
+// which then fails.
+func (l *logFollower) Close() error {
+	l.cancel()
+	return nil
+}
+
+// next fetches the next part of the log into buf. If there is nothing new
+// it checks whether the log is complete, returning io.EOF if it is and
+// waiting for the poll interval if it isn't.
+func (l *logFollower) next() error {
+	data, err := l.fetch()
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		l.offset += int64(len(data))
+		l.buf = data
+		return nil
+	}
+
+	if l.finished {
+		return io.EOF
+	}
+
+	done, err := l.done(l.ctx)
+	if err != nil {
+		return err
+	}
+	if done {
+		l.finished = true
+		return nil
+	}
+
+	return sleepContext(l.ctx, l.interval)
+}
+
+// fetch returns the part of the log after the current offset.
+func (l *logFollower) fetch() ([]byte, error) {
+	request, err := l.c.RequestContext(l.ctx, "GET", l.path, &RequestOptions{
+		Params: map[string]string{
+			"offset": strconv.FormatInt(l.offset, 10),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := l.c.do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer discardResp(response)
+
+	return ioutil.ReadAll(response.Body)
+}
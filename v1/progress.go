@@ -0,0 +1,107 @@
+package atlas
+
+import (
+	"sync"
+	"time"
+)
+
+// progressInterval is the minimum time between two progress reports.
+const progressInterval = 100 * time.Millisecond
+
+// ProgressFunc is called to report the progress of a transfer.
+type ProgressFunc func(Progress)
+
+// Progress describes how far along a transfer is.
+type Progress struct {
+	// Bytes is the number of bytes transferred so far.
+	Bytes int64
+
+	// Total is the total number of bytes, or -1 if it isn't known.
+	Total int64
+
+	// Rate is the average transfer rate so far, in bytes per second.
+	Rate float64
+
+	// ETA is the estimated time until the transfer is complete, or -1 if
+	// it can't be estimated.
+	ETA time.Duration
+}
+
+// progressTracker keeps track of a transfer and reports its progress to a
+// ProgressFunc, at most every progressInterval and once it's complete.
+type progressTracker struct {
+	lock sync.Mutex
+	fn   ProgressFunc
+
+	bytes int64
+	total int64
+
+	// start is when the transfer (re)started, with startBytes transferred.
+	start      time.Time
+	startBytes int64
+
+	lastReport time.Time
+}
+
+// newProgressTracker returns a tracker reporting to fn, which may be nil.
+func newProgressTracker(fn ProgressFunc, bytes, total int64) *progressTracker {
+	return &progressTracker{
+		fn:         fn,
+		bytes:      bytes,
+		total:      total,
+		start:      time.Now(),
+		startBytes: bytes,
+	}
+}
+
+// add records that n more bytes were transferred.
+func (t *progressTracker) add(n int64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.bytes += n
+	t.report(false)
+}
+
+// reset restarts the transfer from the given number of bytes, for example
+// when an upload is retried. A total of -1 leaves the total as it is.
+func (t *progressTracker) reset(bytes, total int64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.bytes = bytes
+	t.startBytes = bytes
+	t.start = time.Now()
+	if total >= 0 {
+		t.total = total
+	}
+	t.report(true)
+}
+
+// report calls the ProgressFunc, unless it was called recently and the
+// transfer isn't complete yet. The lock must be held.
+func (t *progressTracker) report(force bool) {
+	if t.fn == nil {
+		return
+	}
+
+	now := time.Now()
+	complete := t.total >= 0 && t.bytes >= t.total
+	if !force && !complete && now.Sub(t.lastReport) < progressInterval {
+		return
+	}
+	t.lastReport = now
+
+	p := Progress{Bytes: t.bytes, Total: t.total, ETA: -1}
+	if elapsed := now.Sub(t.start).Seconds(); elapsed > 0 {
+		p.Rate = float64(t.bytes-t.startBytes) / elapsed
+	}
+	if t.total >= 0 && p.Rate > 0 {
+		p.ETA = time.Duration(float64(t.total-t.bytes) / p.Rate * float64(time.Second))
+	}
+	if complete {
+		p.ETA = 0
+	}
+
+	t.fn(p)
+}
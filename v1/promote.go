@@ -0,0 +1,180 @@
+package atlas
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+const (
+	// MetadataSourceSlugKey is the metadata key that records the artifact a
+	// copied version came from, as "user/name".
+	MetadataSourceSlugKey = "source_slug"
+
+	// MetadataSourceVersionKey is the metadata key that records the version
+	// number a copied version came from.
+	MetadataSourceVersionKey = "source_version"
+)
+
+// CopyArtifactVersionOpts are the options used to copy an artifact version.
+type CopyArtifactVersionOpts struct {
+	// Source is the version to copy.
+	Source *ArtifactVersion
+
+	// User and Name are the artifact to copy the version to. The type is
+	// the same as the source's. If Name is empty, the source's is used.
+	User string
+	Name string
+
+	// Metadata is added to the metadata copied from the source, replacing
+	// any values with the same keys.
+	Metadata map[string]string
+
+	// DryRun, if set, only works out what would be copied, without copying
+	// anything.
+	DryRun bool
+}
+
+// ArtifactCopy describes a copy of an artifact version.
+type ArtifactCopy struct {
+	// Source is the version that was copied.
+	Source *ArtifactVersion
+
+	// Upload are the options the copy was uploaded with, including the
+	// copied and provenance metadata. File is nil for a dry run.
+	Upload *UploadArtifactOpts
+
+	// Version is the new version, or nil for a dry run.
+	Version *ArtifactVersion
+}
+
+// CopyArtifactVersion copies an artifact version, with its metadata and
+// file, to another artifact. The file is streamed from the source's
+// storage to the new version's, without being stored locally, unless the
+// source's storage doesn't report its size; then it is copied to a
+// temporary file first, because the upload needs the size. The copy
+// gets provenance metadata pointing back to the source (see
+// MetadataSourceSlugKey and MetadataSourceVersionKey).
+func (c *Client) CopyArtifactVersion(opts *CopyArtifactVersionOpts) (*ArtifactCopy, error) {
+	return c.CopyArtifactVersionContext(context.Background(), opts)
+}
+
+// CopyArtifactVersionContext is like CopyArtifactVersion, but uses the
+// given context for the requests, including the file transfer.
+func (c *Client) CopyArtifactVersionContext(ctx context.Context, opts *CopyArtifactVersionOpts) (*ArtifactCopy, error) {
+	src := opts.Source
+	if src == nil {
+		return nil, fmt.Errorf("client: missing source artifact version")
+	}
+	if opts.User == "" {
+		return nil, fmt.Errorf("client: missing user")
+	}
+	if firstNonEmpty(opts.Name, src.Name) == "" {
+		return nil, fmt.Errorf("client: missing name")
+	}
+	if src.Type == "" {
+		return nil, fmt.Errorf("client: missing type")
+	}
+
+	upload := &UploadArtifactOpts{
+		User:     opts.User,
+		Name:     firstNonEmpty(opts.Name, src.Name),
+		Type:     src.Type,
+		ID:       src.ID,
+		Metadata: make(map[string]string, len(src.Metadata)+len(opts.Metadata)+2),
+	}
+	for k, v := range src.Metadata {
+		upload.Metadata[k] = v
+	}
+	upload.Metadata[MetadataSourceSlugKey] = fmt.Sprintf("%s/%s", src.User, src.Name)
+	upload.Metadata[MetadataSourceVersionKey] = strconv.Itoa(src.Version)
+	for k, v := range opts.Metadata {
+		upload.Metadata[k] = v
+	}
+
+	result := &ArtifactCopy{Source: src, Upload: upload}
+	if opts.DryRun {
+		c.logger().Infof("dry run: would copy artifact %s/%s (%s) version %d to %s/%s (file: %t)",
+			src.User, src.Name, src.Type, src.Version, upload.User, upload.Name, src.File)
+		return result, nil
+	}
+
+	c.logger().Infof("copying artifact %s/%s (%s) version %d to %s/%s",
+		src.User, src.Name, src.Type, src.Version, upload.User, upload.Name)
+
+	if src.File {
+		u, err := c.ArtifactFileURL(src)
+		if err != nil {
+			return nil, err
+		}
+
+		// Open the source before creating the new version, so a missing
+		// file doesn't leave an empty version behind.
+		d := &download{c: c, ctx: ctx, path: u.Path, total: -1}
+		resp, err := d.open()
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		upload.File, upload.FileSize = resp.Body, resp.ContentLength
+		if resp.ContentLength < 0 {
+			f, size, err := spoolFile(resp.Body)
+			if err != nil {
+				return nil, err
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+
+			upload.File, upload.FileSize = f, size
+		}
+	}
+
+	av, err := c.UploadArtifactContext(ctx, upload)
+	if err != nil {
+		return nil, err
+	}
+	result.Version = av
+
+	return result, nil
+}
+
+// spoolFile copies r to a new temporary file, returning the file rewound to
+// the start and its size. The caller closes and removes the file.
+func spoolFile(r io.Reader) (*os.File, int64, error) {
+	f, err := ioutil.TempFile("", "atlas-copy-")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size, err := io.Copy(f, r)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, 0, err
+	}
+
+	return f, size, nil
+}
+
+// PromoteArtifactVersion copies an artifact version to the artifact with
+// the same name under another user, such as from "team-dev/app" to
+// "team-prod/app". See CopyArtifactVersion.
+func (c *Client) PromoteArtifactVersion(av *ArtifactVersion, user string) (*ArtifactCopy, error) {
+	return c.PromoteArtifactVersionContext(context.Background(), av, user)
+}
+
+// PromoteArtifactVersionContext is like PromoteArtifactVersion, but uses the
+// given context for the requests, including the file transfer.
+func (c *Client) PromoteArtifactVersionContext(ctx context.Context, av *ArtifactVersion, user string) (*ArtifactCopy, error) {
+	return c.CopyArtifactVersionContext(ctx, &CopyArtifactVersionOpts{
+		Source: av,
+		User:   user,
+	})
+}
@@ -0,0 +1,166 @@
+package atlas
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testPromoteSource() *ArtifactVersion {
+	return &ArtifactVersion{
+		User:     "hashicorp",
+		Name:     "existing",
+		Type:     "vagrant-box",
+		Version:  1,
+		File:     true,
+		Metadata: map[string]string{"provider": "virtualbox"},
+	}
+}
+
+func TestCopyArtifactVersion(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Token = "abcd1234"
+
+	result, err := client.CopyArtifactVersion(&CopyArtifactVersionOpts{
+		Source:   testPromoteSource(),
+		User:     "hashicorp",
+		Name:     "promoted",
+		Metadata: map[string]string{"channel": "stable"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"provider":               "virtualbox",
+		"channel":                "stable",
+		MetadataSourceSlugKey:    "hashicorp/existing",
+		MetadataSourceVersionKey: "1",
+		MetadataChecksumKey:      testArtifactChecksum(),
+		MetadataChecksumTypeKey:  "sha256",
+	}
+	if !reflect.DeepEqual(result.Version.Metadata, expected) {
+		t.Fatalf("bad: %#v", result.Version.Metadata)
+	}
+
+	uploads := server.uploadedBodies()
+	if len(uploads) != 1 || uploads[0] != string(testArtifactFile) {
+		t.Fatalf("expected the artifact file to be uploaded, got %d uploads", len(uploads))
+	}
+}
+
+func TestCopyArtifactVersion_dryRun(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := client.CopyArtifactVersion(&CopyArtifactVersionOpts{
+		Source: testPromoteSource(),
+		User:   "hashicorp",
+		Name:   "promoted",
+		DryRun: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Version != nil {
+		t.Fatalf("bad: %#v", result.Version)
+	}
+	if result.Upload.Metadata[MetadataSourceSlugKey] != "hashicorp/existing" {
+		t.Fatalf("bad: %#v", result.Upload.Metadata)
+	}
+	if uploads := server.uploadedBodies(); len(uploads) != 0 {
+		t.Fatalf("expected nothing to be uploaded, got %d uploads", len(uploads))
+	}
+}
+
+func TestPromoteArtifactVersion_missingFile(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Token = "abcd1234"
+
+	src := testPromoteSource()
+	src.Version = 3
+	if _, err := client.PromoteArtifactVersion(src, "hashicorp"); err == nil {
+		t.Fatal("expected error, but nothing was returned")
+	}
+}
+
+func TestCopyArtifactVersion_unknownSize(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Token = "abcd1234"
+
+	// The storage doesn't send a Content-Length for version 4
+	src := testPromoteSource()
+	src.Version = 4
+	result, err := client.CopyArtifactVersion(&CopyArtifactVersionOpts{
+		Source: src,
+		User:   "hashicorp",
+		Name:   "promoted",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Upload.FileSize != int64(len(testArtifactFile)) {
+		t.Fatalf("bad: %d", result.Upload.FileSize)
+	}
+	uploads := server.uploadedBodies()
+	if len(uploads) != 1 || uploads[0] != string(testArtifactFile) {
+		t.Fatalf("expected the artifact file to be uploaded, got %d uploads", len(uploads))
+	}
+}
+
+func TestCopyArtifactVersion_missingSlug(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Token = "abcd1234"
+
+	noType := testPromoteSource()
+	noType.Type = ""
+
+	cases := []*CopyArtifactVersionOpts{
+		{Source: testPromoteSource()},
+		{Source: &ArtifactVersion{Type: "vagrant-box", Version: 1, File: true}, User: "hashicorp"},
+		{Source: noType, User: "hashicorp"},
+	}
+	for _, opts := range cases {
+		if _, err := client.CopyArtifactVersion(opts); err == nil {
+			t.Fatalf("expected error for %#v, but nothing was returned", opts)
+		}
+	}
+
+	// Nothing is fetched or uploaded
+	if n := server.attemptCount("/api/v1/artifacts/hashicorp/existing/vagrant-box/1/file"); n != 0 {
+		t.Fatalf("expected no requests for the file, got %d", n)
+	}
+	if uploads := server.uploadedBodies(); len(uploads) != 0 {
+		t.Fatalf("expected nothing to be uploaded, got %d uploads", len(uploads))
+	}
+}
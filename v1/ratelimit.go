@@ -0,0 +1,173 @@
+package atlas
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits how fast and how many requests at once a Client sends.
+// It combines a token bucket, which allows Rate requests per second with
+// bursts of up to Burst requests, with a cap of MaxInFlight concurrent
+// requests.
+//
+// The limiter also adapts to the server: when a response says the rate
+// limit is exhausted (X-RateLimit-Remaining is zero, or a 429 is returned)
+// all requests are paused until the time given by X-RateLimit-Reset or
+// Retry-After.
+//
+// A RateLimiter is safe for concurrent use and may be shared by several
+// clients to limit them together.
+type RateLimiter struct {
+	lock        sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+
+	// slots is a semaphore for the in-flight requests, or nil if there is
+	// no limit.
+	slots chan struct{}
+}
+
+// NewRateLimiter creates a RateLimiter allowing rate requests per second
+// with bursts of up to burst requests and at most maxInFlight concurrent
+// requests. A rate of zero or less disables the rate limit, and a
+// maxInFlight of zero or less disables the concurrency limit.
+func NewRateLimiter(rate float64, burst, maxInFlight int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	l := &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+	if maxInFlight > 0 {
+		l.slots = make(chan struct{}, maxInFlight)
+	}
+
+	return l
+}
+
+// Acquire blocks until a request may be sent, or the context is done. The
+// returned function must be called once the request has completed. The
+// Client calls it when the response body is closed, so a request stays in
+// flight while its response is streamed.
+func (l *RateLimiter) Acquire(ctx context.Context) (func(), error) {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	release := func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+
+	for {
+		wait := l.reserve()
+		if wait <= 0 {
+			return release, nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			release()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// reserve takes a token if one is available and returns zero, or returns
+// how long to wait before trying again.
+func (l *RateLimiter) reserve() time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+
+	if l.rate <= 0 {
+		return 0
+	}
+
+	// Refill the bucket for the time that has passed
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// Adapt updates the limiter from the rate limit headers of a response.
+func (l *RateLimiter) Adapt(resp *http.Response) {
+	now := time.Now()
+
+	var until time.Time
+	if resp.StatusCode == 429 {
+		if wait, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			until = now.Add(wait)
+		}
+	}
+
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	hasRemaining := err == nil
+	if (resp.StatusCode == 429 || (hasRemaining && remaining <= 0)) && until.IsZero() {
+		if reset, ok := rateLimitReset(resp.Header.Get("X-RateLimit-Reset"), now); ok {
+			until = reset
+		}
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+
+	// Never allow a burst larger than what the server says is left
+	if hasRemaining && float64(remaining) < l.tokens {
+		l.tokens = float64(remaining)
+		if l.tokens < 0 {
+			l.tokens = 0
+		}
+	}
+}
+
+// rateLimitReset parses the value of an X-RateLimit-Reset header, which is
+// either a Unix timestamp or a number of seconds from now.
+func rateLimitReset(v string, now time.Time) (time.Time, bool) {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return time.Time{}, false
+	}
+
+	// Anything this large can't be a delay, so it must be a timestamp
+	if n > 1000000000 {
+		return time.Unix(n, 0), true
+	}
+
+	return now.Add(time.Duration(n) * time.Second), true
+}
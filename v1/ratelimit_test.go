@@ -0,0 +1,167 @@
+package atlas
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_rate(t *testing.T) {
+	l := NewRateLimiter(100, 2, 0)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		release, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+
+	// Two requests are allowed immediately, the other three are spaced
+	// 10ms apart.
+	if elapsed := time.Since(start); elapsed < 25*time.Millisecond {
+		t.Fatalf("too fast: %s", elapsed)
+	}
+}
+
+func TestRateLimiter_maxInFlight(t *testing.T) {
+	l := NewRateLimiter(0, 1, 2)
+
+	var lock sync.Mutex
+	var inFlight, max int
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			release, err := l.Acquire(context.Background())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer release()
+
+			lock.Lock()
+			inFlight++
+			if inFlight > max {
+				max = inFlight
+			}
+			lock.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			lock.Lock()
+			inFlight--
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if max != 2 {
+		t.Fatalf("expected at most 2 requests in flight, got %d", max)
+	}
+}
+
+func TestRateLimiter_canceled(t *testing.T) {
+	l := NewRateLimiter(0, 1, 1)
+
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
+func TestRateLimiter_adapt(t *testing.T) {
+	l := NewRateLimiter(0, 1, 0)
+
+	resp := &http.Response{StatusCode: 200, Header: make(http.Header)}
+	resp.Header.Set("X-RateLimit-Remaining", "0")
+	resp.Header.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	l.Adapt(resp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("bad: %#v", err)
+	}
+}
+
+func TestRateLimiter_adaptRetryAfter(t *testing.T) {
+	l := NewRateLimiter(0, 1, 0)
+
+	resp := &http.Response{StatusCode: 429, Header: make(http.Header)}
+	resp.Header.Set("Retry-After", "0")
+	l.Adapt(resp)
+
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
+
+func TestClient_rateLimiterStreaming(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Token = "a.atlasv1.b"
+	client.RateLimiter = NewRateLimiter(0, 1, 1)
+
+	d := &download{c: client, ctx: context.Background(),
+		path: "/api/v1/artifacts/hashicorp/existing/vagrant-box/1/file", total: -1}
+	resp, err := d.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The download holds the only slot until it is closed
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.ArtifactContext(ctx, "hashicorp", "existing"); err != context.DeadlineExceeded {
+		t.Fatalf("expected the request to wait for the download, got %v", err)
+	}
+
+	resp.Body.Close()
+	if _, err := client.Artifact("hashicorp", "existing"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClient_rateLimiter(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.RateLimiter = NewRateLimiter(100, 1, 1)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := client.Artifact("hashicorp", "existing"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Fatalf("too fast: %s", elapsed)
+	}
+}
@@ -0,0 +1,195 @@
+package atlas
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy configures how the Client retries requests that fail with a
+// transient error: a connection error, a 429, or a 5xx other than 501.
+//
+// Only requests that are safe to repeat are retried. GET, HEAD and OPTIONS
+// requests are always eligible. PUT and DELETE requests are eligible only if
+// their body can be rewound, which is the case for file uploads whose source
+// is an io.Seeker (such as the temporary file returned by
+// archive.CreateArchive). POST requests are never retried.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of times a request is retried after
+	// the initial attempt. Zero disables retries.
+	MaxRetries int
+
+	// MinWait and MaxWait bound the exponential backoff between attempts.
+	// The wait doubles with every attempt starting at MinWait, is capped
+	// at MaxWait, and has random jitter applied so that many clients don't
+	// retry in lockstep. A wait asked for by the server with a Retry-After
+	// header is capped at MaxWait too.
+	MinWait time.Duration
+	MaxWait time.Duration
+}
+
+// DefaultRetryPolicy returns the RetryPolicy used by clients created with
+// NewClient.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries: 4,
+		MinWait:    500 * time.Millisecond,
+		MaxWait:    30 * time.Second,
+	}
+}
+
+// backoff returns how long to wait before the given retry attempt (starting
+// at zero), honoring the Retry-After header of the response if there is one.
+func (p *RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			if wait > p.MaxWait {
+				wait = p.MaxWait
+			}
+			return wait
+		}
+	}
+
+	wait := p.MinWait
+	for i := 0; i < attempt && wait < p.MaxWait; i++ {
+		wait *= 2
+	}
+	if wait > p.MaxWait {
+		wait = p.MaxWait
+	}
+	if wait <= 0 {
+		return 0
+	}
+
+	// Apply "equal jitter": wait somewhere between half and all of the
+	// computed backoff.
+	half := int64(wait / 2)
+	return time.Duration(half + jitter(half+1))
+}
+
+// retryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date.
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			secs = 0
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		wait := t.Sub(time.Now())
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
+
+// sleep waits for the given duration, returning early with the context's
+// error if it is done first.
+func sleep(ctx context.Context, wait time.Duration) error {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var (
+	jitterLock sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// jitter returns a random number in [0, n).
+func jitter(n int64) int64 {
+	jitterLock.Lock()
+	defer jitterLock.Unlock()
+	return jitterRand.Int63n(n)
+}
+
+// retryable reports whether the request can safely be sent again.
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return true
+	case "PUT", "DELETE":
+		return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	default:
+		return false
+	}
+}
+
+// shouldRetry reports whether the result of a request indicates a transient
+// failure that is worth retrying.
+func shouldRetry(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		// Don't retry if we gave up on the request ourselves.
+		return ctx.Err() == nil
+	}
+
+	switch {
+	case resp.StatusCode == 429:
+		return true
+	case resp.StatusCode == 501:
+		return false
+	case resp.StatusCode >= 500:
+		return true
+	default:
+		return false
+	}
+}
+
+// do sends the request, retrying transient failures according to the
+// client's RetryPolicy, and verifies the final response with checkResp.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	policy := c.RetryPolicy
+	if policy == nil || !retryable(req) {
+		return checkResp(c.send(req))
+	}
+
+	ctx := req.Context()
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(req)
+		if attempt >= policy.MaxRetries || !shouldRetry(ctx, resp, err) {
+			return checkResp(resp, err)
+		}
+
+		wait := policy.backoff(attempt, resp)
+		if err != nil {
+			c.logger().Warnf("request: %s %s failed, retrying in %s: %s",
+				req.Method, req.URL.Path, wait, err)
+		} else {
+			c.logger().Warnf("request: %s %s returned %d, retrying in %s",
+				req.Method, req.URL.Path, resp.StatusCode, wait)
+
+			// Drain and close the body so the connection can be reused
+			discardResp(resp)
+		}
+
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+
+		// Rewind the body for the next attempt
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package atlas
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRetryClient(t *testing.T, server *atlasServer) *Client {
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.RetryPolicy = &RetryPolicy{
+		MaxRetries: 3,
+		MinWait:    time.Millisecond,
+		MaxWait:    5 * time.Millisecond,
+	}
+
+	return client
+}
+
+func TestRetry_transientErrors(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client := testRetryClient(t, server)
+	request, err := client.Request("GET", "/_flaky/2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.do(request); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := server.attemptCount("/_flaky/2"); n != 3 {
+		t.Fatalf("expected 3 attempts, got %d", n)
+	}
+}
+
+func TestRetry_exhausted(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client := testRetryClient(t, server)
+	request, err := client.Request("GET", "/_flaky/10", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.do(request); err == nil {
+		t.Fatal("expected error, but nothing was returned")
+	}
+
+	if n := server.attemptCount("/_flaky/10"); n != 4 {
+		t.Fatalf("expected 4 attempts, got %d", n)
+	}
+}
+
+func TestRetry_disabled(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client := testRetryClient(t, server)
+	client.RetryPolicy = nil
+
+	request, err := client.Request("GET", "/_flaky/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.do(request); err == nil {
+		t.Fatal("expected error, but nothing was returned")
+	}
+}
+
+func TestRetry_post(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client := testRetryClient(t, server)
+	request, err := client.Request("POST", "/_flaky/1", &RequestOptions{
+		Body: strings.NewReader("data"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.do(request); err == nil {
+		t.Fatal("expected error, but nothing was returned")
+	}
+
+	if n := server.attemptCount("/_flaky/1"); n != 1 {
+		t.Fatalf("expected 1 attempt, got %d", n)
+	}
+}
+
+func TestRetry_putFileSeeker(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client := testRetryClient(t, server)
+	data := bytes.NewReader([]byte("hello world"))
+	err := client.putFile(context.Background(),
+		server.URL.String()+"/_binstore-flaky/", data, data.Size(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploads := server.uploadedBodies()
+	expected := []string{"hello world", "hello world"}
+	if len(uploads) != 2 {
+		t.Fatalf("bad: %#v", uploads)
+	}
+	for i, body := range uploads {
+		if body != expected[i] {
+			t.Fatalf("expected %q to be %q", body, expected[i])
+		}
+	}
+}
+
+func TestRetry_putFileNoSeeker(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client := testRetryClient(t, server)
+	// MultiReader hides the Seek method of the underlying reader
+	data := strings.NewReader("hello world")
+	err := client.putFile(context.Background(),
+		server.URL.String()+"/_binstore-flaky/", io.MultiReader(data),
+		data.Size(), nil)
+	if err == nil {
+		t.Fatal("expected error, but nothing was returned")
+	}
+
+	if uploads := server.uploadedBodies(); len(uploads) != 1 {
+		t.Fatalf("bad: %#v", uploads)
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := &RetryPolicy{
+		MinWait: 100 * time.Millisecond,
+		MaxWait: time.Second,
+	}
+
+	cases := []struct {
+		Attempt  int
+		Min, Max time.Duration
+	}{
+		{0, 50 * time.Millisecond, 100 * time.Millisecond},
+		{1, 100 * time.Millisecond, 200 * time.Millisecond},
+		{2, 200 * time.Millisecond, 400 * time.Millisecond},
+		{10, 500 * time.Millisecond, time.Second},
+	}
+
+	for _, tc := range cases {
+		wait := p.backoff(tc.Attempt, nil)
+		if wait < tc.Min || wait > tc.Max {
+			t.Fatalf("%d: expected %s to be in [%s, %s]", tc.Attempt, wait, tc.Min, tc.Max)
+		}
+	}
+}
+
+func TestRetryPolicy_backoffRetryAfter(t *testing.T) {
+	p := DefaultRetryPolicy()
+
+	resp := &http.Response{Header: make(http.Header)}
+	resp.Header.Set("Retry-After", "7")
+	if wait := p.backoff(0, resp); wait != 7*time.Second {
+		t.Fatalf("bad: %s", wait)
+	}
+
+	resp.Header.Set("Retry-After", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	if wait := p.backoff(0, resp); wait != 0 {
+		t.Fatalf("bad: %s", wait)
+	}
+
+	// The server can't make us wait longer than MaxWait
+	resp.Header.Set("Retry-After", "86400")
+	if wait := p.backoff(0, resp); wait != p.MaxWait {
+		t.Fatalf("bad: %s", wait)
+	}
+
+	resp.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	if wait := p.backoff(0, resp); wait != p.MaxWait {
+		t.Fatalf("bad: %s", wait)
+	}
+}
@@ -2,10 +2,13 @@ package atlas
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"net/http"
+	"time"
 )
 
 // TerraformConfigVersion represents a single uploaded version of a
@@ -16,28 +19,51 @@ type TerraformConfigVersion struct {
 	Metadata  map[string]string `json:"metadata"`
 	Variables map[string]string `json:"variables,omitempty"`
 	TFVars    []TFVar           `json:"tf_vars"`
+
+	// CreatedAt is when the version was created, if the server says. It is
+	// ignored when creating a version.
+	CreatedAt *time.Time `json:"created_at,omitempty"`
 }
 
 // TFVar is used to serialize a single Terraform variable sent by the
-// manager as a collection of Variables in a Job payload.
+// manager as a collection of Variables in a Job payload. It is also a
+// variable of an environment, see TerraformVariables.
 type TFVar struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
 	IsHCL bool   `json:"hcl"`
+
+	// Sensitive variables are write-only: their values are never returned
+	// by the client, which sets them to MaskedValue instead.
+	Sensitive bool `json:"sensitive,omitempty"`
 }
 
 // TerraformConfigLatest returns the latest Terraform configuration version.
+// If the configuration exists but has no versions yet, it returns nil and no
+// error. If the configuration doesn't exist, an error matching ErrNotFound
+// (see errors.Is) is returned.
 func (c *Client) TerraformConfigLatest(user, name string) (*TerraformConfigVersion, error) {
-	log.Printf("[INFO] getting terraform configuration %s/%s", user, name)
+	return c.TerraformConfigLatestContext(context.Background(), user, name)
+}
+
+// TerraformConfigLatestContext is like TerraformConfigLatest, but uses the
+// given context for the request.
+func (c *Client) TerraformConfigLatestContext(ctx context.Context, user, name string) (*TerraformConfigVersion, error) {
+	c.logger().Infof("getting terraform configuration %s/%s", user, name)
 
 	endpoint := fmt.Sprintf("/api/v1/terraform/configurations/%s/%s/versions/latest", user, name)
-	request, err := c.Request("GET", endpoint, nil)
+	request, err := c.RequestContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	response, err := checkResp(c.HTTPClient.Do(request))
-	if err == ErrNotFound {
+	response, err := c.do(request)
+	if errors.Is(err, ErrNotFound) {
+		// Tell a configuration without versions from a missing one
+		if err := c.tfConfigExists(ctx, user, name); err != nil {
+			return nil, err
+		}
+
 		return nil, nil
 	}
 	if err != nil {
@@ -58,7 +84,18 @@ func (c *Client) CreateTerraformConfigVersion(
 	user string, name string,
 	version *TerraformConfigVersion,
 	data io.Reader, size int64) (int, error) {
-	log.Printf("[INFO] creating terraform configuration %s/%s", user, name)
+	return c.CreateTerraformConfigVersionContext(context.Background(), user, name, version, data, size, nil)
+}
+
+// CreateTerraformConfigVersionContext is like CreateTerraformConfigVersion,
+// but uses the given context for the requests, including the file upload.
+// The upload options, if not nil, are used for the file upload instead of
+// the client's UploadOptions.
+func (c *Client) CreateTerraformConfigVersionContext(ctx context.Context,
+	user string, name string,
+	version *TerraformConfigVersion,
+	data io.Reader, size int64, opts *UploadOptions) (int, error) {
+	c.logger().Infof("creating terraform configuration %s/%s", user, name)
 
 	endpoint := fmt.Sprintf(
 		"/api/v1/terraform/configurations/%s/%s/versions", user, name)
@@ -69,7 +106,7 @@ func (c *Client) CreateTerraformConfigVersion(
 		return 0, err
 	}
 
-	request, err := c.Request("POST", endpoint, &RequestOptions{
+	request, err := c.RequestContext(ctx, "POST", endpoint, &RequestOptions{
 		Body: bytes.NewReader(body),
 		Headers: map[string]string{
 			"Content-Type": "application/json",
@@ -79,7 +116,7 @@ func (c *Client) CreateTerraformConfigVersion(
 		return 0, err
 	}
 
-	response, err := checkResp(c.HTTPClient.Do(request))
+	response, err := c.do(request)
 	if err != nil {
 		return 0, err
 	}
@@ -89,13 +126,153 @@ func (c *Client) CreateTerraformConfigVersion(
 		return 0, err
 	}
 
-	if err := c.putFile(result.UploadPath, data, size); err != nil {
+	if err := c.putFile(ctx, result.UploadPath, data, size, opts); err != nil {
 		return 0, err
 	}
 
 	return result.Version, nil
 }
 
+// TerraformConfigVersions returns every version of the Terraform
+// configuration. It returns an empty list if the configuration has no
+// versions, and an error matching ErrNotFound (see errors.Is) if it doesn't
+// exist. Use TerraformConfigVersionsIter to fetch the pages of versions as
+// they are needed.
+func (c *Client) TerraformConfigVersions(user, name string) ([]*TerraformConfigVersion, error) {
+	return c.TerraformConfigVersionsContext(context.Background(), user, name)
+}
+
+// TerraformConfigVersionsContext is like TerraformConfigVersions, but uses
+// the given context for the requests.
+func (c *Client) TerraformConfigVersionsContext(ctx context.Context, user, name string) ([]*TerraformConfigVersion, error) {
+	versions, err := c.TerraformConfigVersionsIterContext(ctx, user, name, nil).All()
+	if err != nil {
+		return nil, err
+	}
+
+	if versions == nil {
+		versions = []*TerraformConfigVersion{}
+	}
+
+	return versions, nil
+}
+
+// TerraformConfigVersionsIter returns an iterator over the versions of the
+// Terraform configuration. A nil opts is the same as an empty one.
+func (c *Client) TerraformConfigVersionsIter(user, name string, opts *ListOptions) *TerraformConfigVersionIterator {
+	return c.TerraformConfigVersionsIterContext(context.Background(), user, name, opts)
+}
+
+// TerraformConfigVersionsIterContext is like TerraformConfigVersionsIter,
+// but uses the given context for the requests.
+func (c *Client) TerraformConfigVersionsIterContext(ctx context.Context, user, name string,
+	opts *ListOptions) *TerraformConfigVersionIterator {
+	c.logger().Infof("listing versions of terraform configuration %s/%s", user, name)
+
+	if opts == nil {
+		opts = new(ListOptions)
+	}
+
+	endpoint := fmt.Sprintf("/api/v1/terraform/configurations/%s/%s/versions", user, name)
+
+	it := &TerraformConfigVersionIterator{new(iterator)}
+	it.pager = newPager(ctx, c, endpoint, nil, *opts,
+		func(response *http.Response) ([]interface{}, error) {
+			var w tfConfigVersionsWrapper
+			if err := decodeJSON(response, &w); err != nil {
+				return nil, err
+			}
+
+			items := make([]interface{}, len(w.Versions))
+			for i, v := range w.Versions {
+				items[i] = v
+			}
+			return items, nil
+		})
+
+	return it
+}
+
+// TerraformConfigVersion gets the given version of the Terraform
+// configuration. If the version doesn't exist, an error matching
+// ErrNotFound (see errors.Is) is returned.
+func (c *Client) TerraformConfigVersion(user, name string, version int) (*TerraformConfigVersion, error) {
+	return c.TerraformConfigVersionContext(context.Background(), user, name, version)
+}
+
+// TerraformConfigVersionContext is like TerraformConfigVersion, but uses the
+// given context for the request.
+func (c *Client) TerraformConfigVersionContext(ctx context.Context, user, name string,
+	version int) (*TerraformConfigVersion, error) {
+	c.logger().Infof("getting terraform configuration %s/%s version %d", user, name, version)
+
+	endpoint := fmt.Sprintf("/api/v1/terraform/configurations/%s/%s/versions/%d",
+		user, name, version)
+	request, err := c.RequestContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var wrapper tfConfigVersionWrapper
+	if err := decodeJSON(response, &wrapper); err != nil {
+		return nil, err
+	}
+
+	if wrapper.Version == nil {
+		return nil, fmt.Errorf("client: missing version in response")
+	}
+
+	return wrapper.Version, nil
+}
+
+// DownloadTerraformConfigVersion downloads the slug (the uploaded
+// configuration archive) of the given version of the Terraform configuration
+// into w, returning the number of bytes written. Like DownloadArtifact, the
+// token isn't sent to the storage backend, and interrupted downloads are
+// resumed.
+func (c *Client) DownloadTerraformConfigVersion(user, name string, version int,
+	w io.WriterAt, opts *DownloadArtifactOpts) (int64, error) {
+	return c.DownloadTerraformConfigVersionContext(context.Background(), user, name, version, w, opts)
+}
+
+// DownloadTerraformConfigVersionContext is like
+// DownloadTerraformConfigVersion, but uses the given context for the
+// requests.
+func (c *Client) DownloadTerraformConfigVersionContext(ctx context.Context, user, name string, version int,
+	w io.WriterAt, opts *DownloadArtifactOpts) (int64, error) {
+	c.logger().Infof("downloading terraform configuration %s/%s version %d", user, name, version)
+
+	endpoint := fmt.Sprintf("/api/v1/terraform/configurations/%s/%s/versions/%d/slug",
+		user, name, version)
+	return c.fetchFile(ctx, endpoint, w, 0, nil, opts)
+}
+
+// tfConfigExists returns an error matching ErrNotFound if the Terraform
+// configuration doesn't exist.
+func (c *Client) tfConfigExists(ctx context.Context, user, name string) error {
+	endpoint := fmt.Sprintf("/api/v1/terraform/configurations/%s/%s", user, name)
+	request, err := c.RequestContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := c.do(request)
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("client: terraform configuration %s/%s not found: %w", user, name, err)
+	}
+	if err != nil {
+		return err
+	}
+	discardResp(response)
+
+	return nil
+}
+
 type tfConfigVersionCreate struct {
 	UploadPath string `json:"upload_path"`
 	Version    int
@@ -104,3 +281,7 @@ type tfConfigVersionCreate struct {
 type tfConfigVersionWrapper struct {
 	Version *TerraformConfigVersion `json:"version"`
 }
+
+type tfConfigVersionsWrapper struct {
+	Versions []*TerraformConfigVersion `json:"versions"`
+}
@@ -0,0 +1,376 @@
+package atlas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// RunStatus is the status of a Terraform Run.
+type RunStatus string
+
+// The statuses of a run. A run is planned first; if the plan has changes it
+// waits in RunPlanned until it is confirmed or discarded.
+const (
+	RunPending   RunStatus = "pending"
+	RunPlanning  RunStatus = "planning"
+	RunPlanned   RunStatus = "planned"
+	RunConfirmed RunStatus = "confirmed"
+	RunApplying  RunStatus = "applying"
+	RunApplied   RunStatus = "applied"
+	RunDiscarded RunStatus = "discarded"
+	RunErrored   RunStatus = "errored"
+	RunCanceled  RunStatus = "canceled"
+)
+
+// Done reports whether the status is final, that is the run was applied,
+// discarded, errored or was canceled.
+func (s RunStatus) Done() bool {
+	switch s {
+	case RunApplied, RunDiscarded, RunErrored, RunCanceled:
+		return true
+	default:
+		return false
+	}
+}
+
+// Planned reports whether the plan of a run with this status is done.
+func (s RunStatus) Planned() bool {
+	return s != RunPending && s != RunPlanning
+}
+
+// RunPhase is one of the two phases of a run, each with its own log.
+type RunPhase string
+
+// The phases of a run.
+const (
+	PlanPhase  RunPhase = "plan"
+	ApplyPhase RunPhase = "apply"
+)
+
+// Run is a plan, and possibly an apply, of a version of a Terraform
+// configuration in an environment.
+type Run struct {
+	// ID is the number of the run, unique in the scope of the environment.
+	ID int `json:"id"`
+
+	// User and Name identify the environment, and ConfigVersion is the
+	// version of the Terraform configuration that is run.
+	User          string `json:"username"`
+	Name          string `json:"name"`
+	ConfigVersion int    `json:"configuration_version"`
+
+	Status RunStatus `json:"status"`
+
+	// Message is the message the run was queued with, if any.
+	Message string `json:"message,omitempty"`
+
+	// Destroy is true if the run destroys all the resources of the
+	// environment.
+	Destroy bool `json:"is_destroy"`
+
+	// Plan and Apply are the results of the phases of the run, once they
+	// have started.
+	Plan  *Plan  `json:"plan,omitempty"`
+	Apply *Apply `json:"apply,omitempty"`
+
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// Slug returns the slug format of the environment (User/Name).
+func (r *Run) Slug() string {
+	return fmt.Sprintf("%s/%s", r.User, r.Name)
+}
+
+// Plan is the plan phase of a Run.
+type Plan struct {
+	// HasChanges is false if applying the plan would change nothing.
+	HasChanges bool `json:"has_changes"`
+
+	// ResourceChanges summarizes the changes in the plan.
+	ResourceChanges
+}
+
+// Apply is the apply phase of a Run.
+type Apply struct {
+	// ResourceChanges summarizes the changes that were applied so far.
+	ResourceChanges
+}
+
+// ResourceChanges counts the resources that a plan adds, changes and
+// destroys, or that an apply added, changed and destroyed.
+type ResourceChanges struct {
+	Add     int `json:"additions"`
+	Change  int `json:"changes"`
+	Destroy int `json:"destructions"`
+}
+
+// String returns a summary of the changes like the one Terraform prints,
+// such as "1 to add, 2 to change, 0 to destroy".
+func (rc ResourceChanges) String() string {
+	return fmt.Sprintf("%d to add, %d to change, %d to destroy",
+		rc.Add, rc.Change, rc.Destroy)
+}
+
+// QueueRunOpts are the options for queueing a run.
+type QueueRunOpts struct {
+	// ConfigVersion is the version of the Terraform configuration to run.
+	// If zero, the latest version is run.
+	ConfigVersion int
+
+	// Message is shown with the run, and may be empty.
+	Message string
+
+	// Destroy plans the destruction of all the resources of the
+	// environment.
+	Destroy bool
+}
+
+// runWrapper is the API wrapper around a single Run.
+type runWrapper struct {
+	Run *Run `json:"run"`
+}
+
+// QueueRun queues a run in the given environment. A nil opts is the same as
+// an empty one.
+func (c *Client) QueueRun(user, name string, opts *QueueRunOpts) (*Run, error) {
+	return c.QueueRunContext(context.Background(), user, name, opts)
+}
+
+// QueueRunContext is like QueueRun, but uses the given context for the
+// request.
+func (c *Client) QueueRunContext(ctx context.Context, user, name string, opts *QueueRunOpts) (*Run, error) {
+	c.logger().Infof("queueing run in environment %s/%s", user, name)
+
+	if opts == nil {
+		opts = new(QueueRunOpts)
+	}
+
+	endpoint := fmt.Sprintf("/api/v1/terraform/environments/%s/%s/runs", user, name)
+
+	var bodyData struct {
+		Run struct {
+			ConfigVersion int    `json:"configuration_version,omitempty"`
+			Message       string `json:"message,omitempty"`
+			Destroy       bool   `json:"is_destroy,omitempty"`
+		} `json:"run"`
+	}
+	bodyData.Run.ConfigVersion = opts.ConfigVersion
+	bodyData.Run.Message = opts.Message
+	bodyData.Run.Destroy = opts.Destroy
+	body, err := json.Marshal(bodyData)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := c.RequestContext(ctx, "POST", endpoint, &RequestOptions{
+		Body: bytes.NewReader(body),
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeRun(response, user, name)
+}
+
+// Run gets a single run of the environment. If the run doesn't exist, an
+// error matching ErrNotFound (see errors.Is) is returned.
+func (c *Client) Run(user, name string, id int) (*Run, error) {
+	return c.RunContext(context.Background(), user, name, id)
+}
+
+// RunContext is like Run, but uses the given context for the request.
+func (c *Client) RunContext(ctx context.Context, user, name string, id int) (*Run, error) {
+	c.logger().Infof("getting run %d of %s/%s", id, user, name)
+
+	endpoint := fmt.Sprintf("/api/v1/terraform/environments/%s/%s/runs/%d", user, name, id)
+	request, err := c.RequestContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeRun(response, user, name)
+}
+
+// WaitForRun polls the run until it is done, or until it is planned and
+// waits for confirmation, and returns it in that state. A run that errored
+// or was canceled isn't an error; check its Status. A nil opts is the same
+// as an empty one.
+func (c *Client) WaitForRun(user, name string, id int, opts *PollOptions) (*Run, error) {
+	return c.WaitForRunContext(context.Background(), user, name, id, opts)
+}
+
+// WaitForRunContext is like WaitForRun, but uses the given context for the
+// requests.
+func (c *Client) WaitForRunContext(ctx context.Context, user, name string, id int,
+	opts *PollOptions) (*Run, error) {
+	c.logger().Infof("waiting for run %d of %s/%s", id, user, name)
+
+	var run *Run
+	err := poll(ctx, opts, func(ctx context.Context) (bool, error) {
+		var err error
+		run, err = c.RunContext(ctx, user, name, id)
+		if err != nil {
+			return false, err
+		}
+
+		c.logger().Debugf("run %d of %s/%s is %s", id, user, name, run.Status)
+		return run.Status.Done() || run.Status == RunPlanned, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+// ConfirmRun confirms a planned run, so that its plan is applied. If the run
+// isn't waiting for confirmation, an error matching ErrConflict (see
+// errors.Is) is returned.
+func (c *Client) ConfirmRun(user, name string, id int) (*Run, error) {
+	return c.ConfirmRunContext(context.Background(), user, name, id)
+}
+
+// ConfirmRunContext is like ConfirmRun, but uses the given context for the
+// request.
+func (c *Client) ConfirmRunContext(ctx context.Context, user, name string, id int) (*Run, error) {
+	c.logger().Infof("confirming run %d of %s/%s", id, user, name)
+	return c.runAction(ctx, user, name, id, "confirm")
+}
+
+// DiscardRun discards a planned run, so that its plan is never applied. If
+// the run isn't waiting for confirmation, an error matching ErrConflict (see
+// errors.Is) is returned.
+func (c *Client) DiscardRun(user, name string, id int) (*Run, error) {
+	return c.DiscardRunContext(context.Background(), user, name, id)
+}
+
+// DiscardRunContext is like DiscardRun, but uses the given context for the
+// request.
+func (c *Client) DiscardRunContext(ctx context.Context, user, name string, id int) (*Run, error) {
+	c.logger().Infof("discarding run %d of %s/%s", id, user, name)
+	return c.runAction(ctx, user, name, id, "discard")
+}
+
+// PlanOutput returns the output of the plan of the run, as much of it as
+// there is so far. Use WaitForRun first to get the whole plan, or RunLog to
+// follow it as it is written.
+func (c *Client) PlanOutput(user, name string, id int) (string, error) {
+	return c.PlanOutputContext(context.Background(), user, name, id)
+}
+
+// PlanOutputContext is like PlanOutput, but uses the given context for the
+// request.
+func (c *Client) PlanOutputContext(ctx context.Context, user, name string, id int) (string, error) {
+	c.logger().Infof("getting plan output of run %d of %s/%s", id, user, name)
+
+	request, err := c.RequestContext(ctx, "GET", runLogPath(user, name, id, PlanPhase), nil)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return "", err
+	}
+	defer discardResp(response)
+
+	output, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(output), nil
+}
+
+// RunLog returns the log of the given phase of the run. Like BuildLog, the
+// log is read as it is written, and io.EOF is only returned once the phase
+// is done and all of its output was read. The returned reader must be
+// closed. A nil opts is the same as an empty one.
+func (c *Client) RunLog(user, name string, id int, phase RunPhase, opts *PollOptions) io.ReadCloser {
+	return c.RunLogContext(context.Background(), user, name, id, phase, opts)
+}
+
+// RunLogContext is like RunLog, but uses the given context for the
+// requests.
+func (c *Client) RunLogContext(ctx context.Context, user, name string, id int,
+	phase RunPhase, opts *PollOptions) io.ReadCloser {
+	c.logger().Infof("following %s log of run %d of %s/%s", phase, id, user, name)
+
+	return c.followLog(ctx, runLogPath(user, name, id, phase), opts,
+		func(ctx context.Context) (bool, error) {
+			run, err := c.RunContext(ctx, user, name, id)
+			if err != nil {
+				return false, err
+			}
+
+			if phase == PlanPhase {
+				return run.Status.Planned(), nil
+			}
+
+			return run.Status.Done(), nil
+		})
+}
+
+// runAction sends the given action, such as "confirm", for a run.
+func (c *Client) runAction(ctx context.Context, user, name string, id int, action string) (*Run, error) {
+	endpoint := fmt.Sprintf("/api/v1/terraform/environments/%s/%s/runs/%d/%s",
+		user, name, id, action)
+	request, err := c.RequestContext(ctx, "POST", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeRun(response, user, name)
+}
+
+// runLogPath returns the API path of the log of the given phase of a run.
+func runLogPath(user, name string, id int, phase RunPhase) string {
+	return fmt.Sprintf("/api/v1/terraform/environments/%s/%s/runs/%d/%s/log",
+		user, name, id, phase)
+}
+
+// decodeRun decodes a single wrapped Run from the response.
+func decodeRun(response *http.Response, user, name string) (*Run, error) {
+	var w runWrapper
+	if err := decodeJSON(response, &w); err != nil {
+		return nil, err
+	}
+
+	if w.Run == nil {
+		return nil, fmt.Errorf("client: missing run in response")
+	}
+
+	if w.Run.User == "" {
+		w.Run.User = user
+	}
+	if w.Run.Name == "" {
+		w.Run.Name = name
+	}
+
+	return w.Run, nil
+}
@@ -0,0 +1,213 @@
+package atlas
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestRunStatus(t *testing.T) {
+	cases := []struct {
+		status  RunStatus
+		planned bool
+		done    bool
+	}{
+		{RunPending, false, false},
+		{RunPlanning, false, false},
+		{RunPlanned, true, false},
+		{RunConfirmed, true, false},
+		{RunApplying, true, false},
+		{RunApplied, true, true},
+		{RunDiscarded, true, true},
+		{RunErrored, true, true},
+		{RunCanceled, true, true},
+	}
+
+	for _, tc := range cases {
+		if tc.status.Planned() != tc.planned {
+			t.Errorf("expected %q planned to be %t", tc.status, tc.planned)
+		}
+		if tc.status.Done() != tc.done {
+			t.Errorf("expected %q done to be %t", tc.status, tc.done)
+		}
+	}
+}
+
+func TestResourceChanges_String(t *testing.T) {
+	rc := ResourceChanges{Add: 1, Change: 2}
+	expected := "1 to add, 2 to change, 0 to destroy"
+	if rc.String() != expected {
+		t.Fatalf("expected %q to be %q", rc.String(), expected)
+	}
+}
+
+func TestQueueRun(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := client.QueueRun("hashicorp", "existing", &QueueRunOpts{
+		ConfigVersion: 5,
+		Message:       "testing",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if run.ID != 7 || run.Slug() != "hashicorp/existing" || run.ConfigVersion != 5 {
+		t.Fatalf("bad: %#v", run)
+	}
+
+	if run.Status != RunPending || run.Message != "testing" || run.Destroy {
+		t.Fatalf("bad: %#v", run)
+	}
+}
+
+func TestRun_notFound(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Run("hashicorp", "existing", 9)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v to be ErrNotFound", err)
+	}
+}
+
+func TestWaitForRun(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := client.WaitForRun("hashicorp", "existing", 7, &PollOptions{
+		Interval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if run.Status != RunPlanned {
+		t.Fatalf("expected %q to be %q", run.Status, RunPlanned)
+	}
+
+	expected := ResourceChanges{Add: 1, Change: 2}
+	if run.Plan == nil || !run.Plan.HasChanges || run.Plan.ResourceChanges != expected {
+		t.Fatalf("bad: %#v", run.Plan)
+	}
+
+	if _, err := client.ConfirmRun("hashicorp", "existing", 7); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err = client.WaitForRun("hashicorp", "existing", 7, &PollOptions{
+		Interval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if run.Status != RunApplied {
+		t.Fatalf("expected %q to be %q", run.Status, RunApplied)
+	}
+}
+
+func TestDiscardRun(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := client.DiscardRun("hashicorp", "existing", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if run.Status != RunDiscarded {
+		t.Fatalf("expected %q to be %q", run.Status, RunDiscarded)
+	}
+}
+
+func TestConfirmRun_conflict(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.ConfirmRun("hashicorp", "existing", 8)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected %v to be ErrConflict", err)
+	}
+
+	_, err = client.DiscardRun("hashicorp", "existing", 8)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected %v to be ErrConflict", err)
+	}
+}
+
+func TestPlanOutput(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := client.PlanOutput("hashicorp", "existing", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if output != testPlanLog {
+		t.Fatalf("expected %q to be %q", output, testPlanLog)
+	}
+}
+
+func TestRunLog(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := client.RunLog("hashicorp", "existing", 7, PlanPhase, &PollOptions{
+		Interval: time.Millisecond,
+	})
+	defer log.Close()
+
+	data, err := ioutil.ReadAll(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != testPlanLog {
+		t.Fatalf("expected %q to be %q", data, testPlanLog)
+	}
+
+	// The log is only done once the plan is
+	path := "/api/v1/terraform/environments/hashicorp/existing/runs/7"
+	if n := server.attemptCount(path); n != 3 {
+		t.Errorf("expected %d to be %d", n, 3)
+	}
+}
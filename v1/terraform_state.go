@@ -0,0 +1,451 @@
+package atlas
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	osuser "os/user"
+	"strings"
+	"time"
+)
+
+// StatePayload is the Terraform state of an environment, as stored by
+// Atlas.
+type StatePayload struct {
+	// Data is the JSON-encoded state.
+	Data []byte
+
+	// MD5 is the MD5 checksum of Data.
+	MD5 []byte
+}
+
+// StateOpts are the options for writing or deleting the state of an
+// environment.
+type StateOpts struct {
+	// LockID is the ID of the lock held on the state, as returned by
+	// LockState. Atlas refuses changes to a locked state without it.
+	LockID string
+
+	// Force overwrites the state even if Atlas reports that it conflicts
+	// with the state it has, for example because the serial is the same but
+	// the contents differ. It is ignored by DeleteState.
+	Force bool
+}
+
+// LockInfo describes a lock held on the state of an environment. It has the
+// same fields as the lock info of Terraform, so it can be shown the same
+// way.
+type LockInfo struct {
+	// ID is the unique ID of the lock, which is needed to release it.
+	ID string
+
+	// Operation is the Terraform operation that holds the lock, such as
+	// "OperationTypeApply", and Info is any extra information about it.
+	Operation string
+	Info      string
+
+	// Who is the user and host holding the lock, and Version is the version
+	// of the tool that took it.
+	Who     string
+	Version string
+
+	// Created is when the lock was taken.
+	Created time.Time
+
+	// Path is the path of the state that is locked.
+	Path string
+}
+
+// String returns a description of the lock for messages to the user.
+func (i *LockInfo) String() string {
+	return fmt.Sprintf("ID: %s, operation: %s, who: %s, created: %s",
+		i.ID, i.Operation, i.Who, i.Created.Format(time.RFC3339))
+}
+
+// StateLockedError is returned when the state of an environment is locked by
+// someone else. It wraps the *APIError of the response.
+type StateLockedError struct {
+	User string
+	Name string
+
+	// Info is the lock that is held, if Atlas returned it.
+	Info *LockInfo
+
+	Err error
+}
+
+func (e *StateLockedError) Error() string {
+	if e.Info == nil {
+		return fmt.Sprintf("client: state of %s/%s is locked: %s", e.User, e.Name, e.Err)
+	}
+
+	return fmt.Sprintf("client: state of %s/%s is locked (%s): %s",
+		e.User, e.Name, e.Info, e.Err)
+}
+
+// Unwrap returns the *APIError of the response.
+func (e *StateLockedError) Unwrap() error {
+	return e.Err
+}
+
+// GetState returns the Terraform state of the environment. If the
+// environment has no state yet, it returns nil and no error. If the
+// environment doesn't exist, an error matching ErrNotFound (see errors.Is) is
+// returned. If Atlas sends an MD5 checksum with the state, the state is
+// verified against it.
+func (c *Client) GetState(user, name string) (*StatePayload, error) {
+	return c.GetStateContext(context.Background(), user, name)
+}
+
+// GetStateContext is like GetState, but uses the given context for the
+// request.
+func (c *Client) GetStateContext(ctx context.Context, user, name string) (*StatePayload, error) {
+	c.logger().Infof("getting state of %s/%s", user, name)
+
+	request, err := c.RequestContext(ctx, "GET", statePath(user, name), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer discardResp(response)
+
+	if response.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	sum := md5.Sum(data)
+	if v := response.Header.Get("Content-MD5"); v != "" {
+		expected, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("client: error decoding state MD5 %q: %s", v, err)
+		}
+
+		if !bytes.Equal(expected, sum[:]) {
+			return nil, &ChecksumError{
+				Type:     "md5",
+				Expected: hex.EncodeToString(expected),
+				Actual:   hex.EncodeToString(sum[:]),
+			}
+		}
+	}
+
+	return &StatePayload{Data: data, MD5: sum[:]}, nil
+}
+
+// PutState writes the Terraform state of the environment. The state is sent
+// with its MD5 checksum, which Atlas verifies. If the state is locked by
+// someone else, a *StateLockedError is returned. A nil opts is the same as
+// an empty one.
+func (c *Client) PutState(user, name string, data []byte, opts *StateOpts) error {
+	return c.PutStateContext(context.Background(), user, name, data, opts)
+}
+
+// PutStateContext is like PutState, but uses the given context for the
+// request.
+func (c *Client) PutStateContext(ctx context.Context, user, name string, data []byte, opts *StateOpts) error {
+	c.logger().Infof("putting state of %s/%s (%d bytes)", user, name, len(data))
+
+	if opts == nil {
+		opts = new(StateOpts)
+	}
+
+	sum := md5.Sum(data)
+	request, err := c.RequestContext(ctx, "PUT", statePath(user, name), &RequestOptions{
+		Params: opts.params(),
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+			"Content-MD5":  base64.StdEncoding.EncodeToString(sum[:]),
+		},
+		Body:       bytes.NewReader(data),
+		BodyLength: int64(len(data)),
+	})
+	if err != nil {
+		return err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return stateLockedError(user, name, err)
+	}
+	discardResp(response)
+
+	return nil
+}
+
+// DeleteState deletes the Terraform state of the environment. Deleting a
+// state that doesn't exist isn't an error. If the state is locked by
+// someone else, a *StateLockedError is returned. A nil opts is the same as
+// an empty one.
+func (c *Client) DeleteState(user, name string, opts *StateOpts) error {
+	return c.DeleteStateContext(context.Background(), user, name, opts)
+}
+
+// DeleteStateContext is like DeleteState, but uses the given context for
+// the request.
+func (c *Client) DeleteStateContext(ctx context.Context, user, name string, opts *StateOpts) error {
+	c.logger().Infof("deleting state of %s/%s", user, name)
+
+	if opts == nil {
+		opts = new(StateOpts)
+	}
+
+	params := opts.params()
+	delete(params, "force")
+	request, err := c.RequestContext(ctx, "DELETE", statePath(user, name), &RequestOptions{
+		Params: params,
+	})
+	if err != nil {
+		return err
+	}
+
+	response, err := c.do(request)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return stateLockedError(user, name, err)
+	}
+	discardResp(response)
+
+	return nil
+}
+
+// LockState locks the Terraform state of the environment, returning the ID
+// of the lock. If info.ID is empty a random ID is used, and Who and Created
+// are filled in if they are empty. If the state is locked already, a
+// *StateLockedError describing the lock is returned, unless the lock has
+// the requested ID; then an earlier attempt took it, and its response was
+// lost.
+func (c *Client) LockState(user, name string, info *LockInfo) (string, error) {
+	return c.LockStateContext(context.Background(), user, name, info)
+}
+
+// LockStateContext is like LockState, but uses the given context for the
+// request.
+func (c *Client) LockStateContext(ctx context.Context, user, name string, info *LockInfo) (string, error) {
+	c.logger().Infof("locking state of %s/%s", user, name)
+
+	lock := LockInfo{}
+	if info != nil {
+		lock = *info
+	}
+	if lock.ID == "" {
+		id, err := newLockID()
+		if err != nil {
+			return "", err
+		}
+		lock.ID = id
+	}
+	if lock.Who == "" {
+		lock.Who = lockWho()
+	}
+	if lock.Created.IsZero() {
+		lock.Created = time.Now().UTC()
+	}
+	if lock.Path == "" {
+		lock.Path = fmt.Sprintf("%s/%s", user, name)
+	}
+
+	body, err := json.Marshal(&lock)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := c.RequestContext(ctx, "PUT", statePath(user, name)+"/lock", &RequestOptions{
+		Body: bytes.NewReader(body),
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		err = stateLockedError(user, name, err)
+
+		var lockErr *StateLockedError
+		if !errors.As(err, &lockErr) || lockErr.Info == nil || lockErr.Info.ID != lock.ID {
+			return "", err
+		}
+		c.logger().Debugf("state of %s/%s is already locked with %s", user, name, lock.ID)
+		return lock.ID, nil
+	}
+	discardResp(response)
+
+	return lock.ID, nil
+}
+
+// UnlockState releases the lock with the given ID on the Terraform state of
+// the environment. If the state is locked with another ID, a
+// *StateLockedError describing that lock is returned.
+func (c *Client) UnlockState(user, name, id string) error {
+	return c.UnlockStateContext(context.Background(), user, name, id)
+}
+
+// UnlockStateContext is like UnlockState, but uses the given context for
+// the request.
+func (c *Client) UnlockStateContext(ctx context.Context, user, name, id string) error {
+	c.logger().Infof("unlocking state of %s/%s", user, name)
+	return c.unlockState(ctx, user, name, map[string]string{"lock_id": id})
+}
+
+// ForceUnlockState releases any lock held on the Terraform state of the
+// environment, whoever holds it. It is meant for recovering from a lock
+// that was never released, for example because Terraform crashed.
+func (c *Client) ForceUnlockState(user, name string) error {
+	return c.ForceUnlockStateContext(context.Background(), user, name)
+}
+
+// ForceUnlockStateContext is like ForceUnlockState, but uses the given
+// context for the request.
+func (c *Client) ForceUnlockStateContext(ctx context.Context, user, name string) error {
+	c.logger().Warnf("force unlocking state of %s/%s", user, name)
+	return c.unlockState(ctx, user, name, map[string]string{"force": "true"})
+}
+
+// StateLock returns the lock held on the Terraform state of the
+// environment, or nil if it isn't locked.
+func (c *Client) StateLock(user, name string) (*LockInfo, error) {
+	return c.StateLockContext(context.Background(), user, name)
+}
+
+// StateLockContext is like StateLock, but uses the given context for the
+// request.
+func (c *Client) StateLockContext(ctx context.Context, user, name string) (*LockInfo, error) {
+	c.logger().Infof("getting state lock of %s/%s", user, name)
+
+	request, err := c.RequestContext(ctx, "GET", statePath(user, name)+"/lock", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusNoContent {
+		discardResp(response)
+		return nil, nil
+	}
+
+	var info LockInfo
+	if err := decodeJSON(response, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// unlockState deletes the lock on the state with the given params.
+func (c *Client) unlockState(ctx context.Context, user, name string, params map[string]string) error {
+	request, err := c.RequestContext(ctx, "DELETE", statePath(user, name)+"/lock", &RequestOptions{
+		Params: params,
+	})
+	if err != nil {
+		return err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return stateLockedError(user, name, err)
+	}
+	discardResp(response)
+
+	return nil
+}
+
+// params returns the request params for the options.
+func (o *StateOpts) params() map[string]string {
+	params := make(map[string]string)
+	if o.LockID != "" {
+		params["lock_id"] = o.LockID
+	}
+	if o.Force {
+		params["force"] = "true"
+	}
+
+	return params
+}
+
+// stateAPIPath is the API path under which the state of environments lives.
+const stateAPIPath = "/api/v1/terraform/state/"
+
+// statePath returns the API path of the state of an environment.
+func statePath(user, name string) string {
+	return fmt.Sprintf("%s%s/%s", stateAPIPath, user, name)
+}
+
+// isStatePath reports whether the request path is that of the state of an
+// environment, as opposed to its lock.
+func isStatePath(p string) bool {
+	i := strings.Index(p, stateAPIPath)
+	return i >= 0 && strings.Count(p[i+len(stateAPIPath):], "/") == 1
+}
+
+// stateLockedError turns the error of a request that failed because the
+// state is locked (a 423) into a *StateLockedError, reading the lock info
+// from the response. Other errors are returned as they are.
+func stateLockedError(user, name string, err error) error {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusLocked {
+		return err
+	}
+
+	lockErr := &StateLockedError{User: user, Name: name, Err: err}
+
+	var info LockInfo
+	if json.Unmarshal(apiErr.Body, &info) == nil && info.ID != "" {
+		lockErr.Info = &info
+	}
+
+	return lockErr
+}
+
+// newLockID returns a random lock ID.
+func newLockID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("client: error generating lock ID: %s", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// lockWho returns the user and host taking a lock, like Terraform does.
+func lockWho() string {
+	name := "unknown"
+	if u, err := osuser.Current(); err == nil {
+		name = u.Username
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%s@%s", name, host)
+}
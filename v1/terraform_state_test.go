@@ -0,0 +1,239 @@
+package atlas
+
+import (
+	"crypto/md5"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestState(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := client.GetState("hashicorp", "existing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != nil {
+		t.Fatalf("expected no state, got %#v", state)
+	}
+
+	data := []byte(`{"version": 3, "serial": 1}`)
+	if err := client.PutState("hashicorp", "existing", data, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = client.GetState("hashicorp", "existing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := md5.Sum(data)
+	if string(state.Data) != string(data) || string(state.MD5) != string(sum[:]) {
+		t.Fatalf("bad: %#v", state)
+	}
+
+	if err := client.DeleteState("hashicorp", "existing", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = client.GetState("hashicorp", "existing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != nil {
+		t.Fatalf("expected no state, got %#v", state)
+	}
+}
+
+func TestGetState_missing(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.GetState("hashicorp", "missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v to be ErrNotFound", err)
+	}
+}
+
+func TestGetState_logging(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := new(testLogger)
+	client.Logger = l
+
+	data := []byte(`{"version": 3, "outputs": {"password": "hunter2"}}`)
+	if err := client.PutState("hashicorp", "existing", data, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := client.GetState("hashicorp", "existing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(state.Data) != string(data) {
+		t.Fatalf("expected %q to be %q", state.Data, data)
+	}
+
+	output := l.String()
+	if !strings.Contains(output, "Terraform state not logged") {
+		t.Fatalf("expected the state to be left out:\n%s", output)
+	}
+	if strings.Contains(output, "hunter2") {
+		t.Fatalf("state was logged:\n%s", output)
+	}
+}
+
+func TestIsStatePath(t *testing.T) {
+	cases := map[string]bool{
+		"/api/v1/terraform/state/hashicorp/existing":        true,
+		"/atlas/api/v1/terraform/state/hashicorp/existing":  true,
+		"/api/v1/terraform/state/hashicorp/existing/lock":   false,
+		"/api/v1/terraform/environments/hashicorp/existing": false,
+	}
+
+	for p, expected := range cases {
+		if actual := isStatePath(p); actual != expected {
+			t.Errorf("expected %q to be %t, got %t", p, expected, actual)
+		}
+	}
+}
+
+func TestGetState_badMD5(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.GetState("hashicorp", "corrupt")
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) || checksumErr.Type != "md5" {
+		t.Fatalf("expected a md5 *ChecksumError, got %v", err)
+	}
+}
+
+func TestStateLock(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := client.LockState("hashicorp", "existing", &LockInfo{Operation: "OperationTypeApply"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == "" {
+		t.Fatal("expected a lock ID")
+	}
+
+	info, err := client.StateLock("hashicorp", "existing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != id || info.Operation != "OperationTypeApply" || info.Who == "" || info.Created.IsZero() {
+		t.Fatalf("bad: %#v", info)
+	}
+
+	// Someone else can't take the lock or change the state
+	_, err = client.LockState("hashicorp", "existing", nil)
+	var lockErr *StateLockedError
+	if !errors.As(err, &lockErr) || lockErr.Info == nil || lockErr.Info.ID != id {
+		t.Fatalf("expected a *StateLockedError, got %v", err)
+	}
+
+	data := []byte(`{"version": 3, "serial": 2}`)
+	err = client.PutState("hashicorp", "existing", data, nil)
+	if !errors.As(err, &lockErr) {
+		t.Fatalf("expected a *StateLockedError, got %v", err)
+	}
+
+	err = client.UnlockState("hashicorp", "existing", "other")
+	if !errors.As(err, &lockErr) {
+		t.Fatalf("expected a *StateLockedError, got %v", err)
+	}
+
+	// The holder of the lock can
+	if err := client.PutState("hashicorp", "existing", data, &StateOpts{LockID: id}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.UnlockState("hashicorp", "existing", id); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err = client.StateLock("hashicorp", "existing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info != nil {
+		t.Fatalf("expected no lock, got %#v", info)
+	}
+}
+
+func TestLockState_lostResponse(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client := testRetryClient(t, server)
+
+	// The retry finds the lock taken by the first attempt
+	id, err := client.LockState("hashicorp", "flaky", &LockInfo{ID: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "abc" {
+		t.Fatalf("bad: %s", id)
+	}
+
+	// Someone else still can't take it
+	_, err = client.LockState("hashicorp", "flaky", &LockInfo{ID: "def"})
+	var lockErr *StateLockedError
+	if !errors.As(err, &lockErr) || lockErr.Info == nil || lockErr.Info.ID != "abc" {
+		t.Fatalf("expected a *StateLockedError, got %v", err)
+	}
+}
+
+func TestForceUnlockState(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.LockState("hashicorp", "existing", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.ForceUnlockState("hashicorp", "existing"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.DeleteState("hashicorp", "existing", nil); err != nil {
+		t.Fatal(err)
+	}
+}
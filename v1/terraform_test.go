@@ -2,6 +2,8 @@ package atlas
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"reflect"
 	"testing"
 )
@@ -31,6 +33,40 @@ func TestTerraformConfigLatest(t *testing.T) {
 	}
 }
 
+func TestTerraformConfigLatest_noVersions(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := client.TerraformConfigLatest("hashicorp", "empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual != nil {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestTerraformConfigLatest_notFound(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.TerraformConfigLatest("hashicorp", "missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v to be ErrNotFound", err)
+	}
+}
+
 func TestCreateTerraformConfigVersion(t *testing.T) {
 	server := newTestAtlasServer(t)
 	defer server.Stop()
@@ -55,3 +91,119 @@ func TestCreateTerraformConfigVersion(t *testing.T) {
 		t.Fatalf("bad: %v", vsn)
 	}
 }
+
+func TestCreateTerraformConfigVersionContext_uploadOptions(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress := new(testProgress)
+	v := &TerraformConfigVersion{Version: 5}
+	data := bytes.NewReader([]byte("hello"))
+	_, err = client.CreateTerraformConfigVersionContext(context.Background(),
+		"hashicorp", "existing", v, data, data.Size(), &UploadOptions{Progress: progress.report})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := progress.last()
+	if last.Bytes != 5 || last.Total != 5 {
+		t.Fatalf("bad: %#v", last)
+	}
+}
+
+func TestTerraformConfigVersions(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := client.TerraformConfigVersions("hashicorp", "existing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(versions) != 2 || versions[0].Version != 4 || versions[1].Version != 5 {
+		t.Fatalf("bad: %#v", versions)
+	}
+
+	expected := map[string]string{"foo": "baz"}
+	if !reflect.DeepEqual(versions[0].Metadata, expected) {
+		t.Fatalf("expected %#v to be %#v", versions[0].Metadata, expected)
+	}
+}
+
+func TestTerraformConfigVersions_empty(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := client.TerraformConfigVersions("hashicorp", "empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if versions == nil || len(versions) != 0 {
+		t.Fatalf("bad: %#v", versions)
+	}
+
+	_, err = client.TerraformConfigVersions("hashicorp", "missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v to be ErrNotFound", err)
+	}
+}
+
+func TestTerraformConfigVersion(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := client.TerraformConfigVersion("hashicorp", "existing", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Version != 4 {
+		t.Fatalf("expected %d to be %d", v.Version, 4)
+	}
+
+	_, err = client.TerraformConfigVersion("hashicorp", "existing", 6)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v to be ErrNotFound", err)
+	}
+}
+
+func TestDownloadTerraformConfigVersion(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := new(memWriterAt)
+	n, err := client.DownloadTerraformConfigVersion("hashicorp", "existing", 5, w, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != int64(len(testArtifactFile)) || !bytes.Equal(w.buf, testArtifactFile) {
+		t.Fatalf("bad: %d bytes", n)
+	}
+}
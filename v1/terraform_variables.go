@@ -0,0 +1,332 @@
+package atlas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// tfVarWrapper is the API wrapper around a single TFVar.
+type tfVarWrapper struct {
+	Variable *TFVar `json:"variable"`
+}
+
+// tfVarsWrapper is the API wrapper around a list of TFVars.
+type tfVarsWrapper struct {
+	Variables []TFVar `json:"variables"`
+}
+
+// TerraformVariables returns the variables of the environment, sorted by
+// key. The values of sensitive variables are MaskedValue.
+func (c *Client) TerraformVariables(user, name string) ([]TFVar, error) {
+	return c.TerraformVariablesContext(context.Background(), user, name)
+}
+
+// TerraformVariablesContext is like TerraformVariables, but uses the given
+// context for the request.
+func (c *Client) TerraformVariablesContext(ctx context.Context, user, name string) ([]TFVar, error) {
+	c.logger().Infof("listing variables of environment %s/%s", user, name)
+
+	request, err := c.RequestContext(ctx, "GET", tfVarsPath(user, name), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var w tfVarsWrapper
+	if err := decodeJSON(response, &w); err != nil {
+		return nil, err
+	}
+
+	vars := make([]TFVar, len(w.Variables))
+	for i, v := range w.Variables {
+		vars[i] = *c.maskTFVar(&v)
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Key < vars[j].Key })
+
+	return vars, nil
+}
+
+// TerraformVariable gets a single variable of the environment. If the
+// variable doesn't exist, an error matching ErrNotFound (see errors.Is) is
+// returned. The value of a sensitive variable is MaskedValue.
+func (c *Client) TerraformVariable(user, name, key string) (*TFVar, error) {
+	return c.TerraformVariableContext(context.Background(), user, name, key)
+}
+
+// TerraformVariableContext is like TerraformVariable, but uses the given
+// context for the request.
+func (c *Client) TerraformVariableContext(ctx context.Context, user, name, key string) (*TFVar, error) {
+	c.logger().Infof("getting variable %s of environment %s/%s", key, user, name)
+
+	request, err := c.requestURL(ctx, "GET", c.tfVarURL(user, name, key), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.decodeTFVar(response)
+}
+
+// CreateTerraformVariable adds a variable to the environment. If a variable
+// with the same key exists already, an error matching ErrConflict (see
+// errors.Is) is returned.
+func (c *Client) CreateTerraformVariable(user, name string, v TFVar) (*TFVar, error) {
+	return c.CreateTerraformVariableContext(context.Background(), user, name, v)
+}
+
+// CreateTerraformVariableContext is like CreateTerraformVariable, but uses
+// the given context for the request.
+func (c *Client) CreateTerraformVariableContext(ctx context.Context, user, name string, v TFVar) (*TFVar, error) {
+	c.logger().Infof("creating variable %s of environment %s/%s", v.Key, user, name)
+	return c.writeTFVar(ctx, "POST", c.endpointURL(tfVarsPath(user, name)), v)
+}
+
+// UpdateTerraformVariable replaces the value and flags of an existing
+// variable of the environment. If the variable doesn't exist, an error
+// matching ErrNotFound (see errors.Is) is returned.
+func (c *Client) UpdateTerraformVariable(user, name string, v TFVar) (*TFVar, error) {
+	return c.UpdateTerraformVariableContext(context.Background(), user, name, v)
+}
+
+// UpdateTerraformVariableContext is like UpdateTerraformVariable, but uses
+// the given context for the request.
+func (c *Client) UpdateTerraformVariableContext(ctx context.Context, user, name string, v TFVar) (*TFVar, error) {
+	c.logger().Infof("updating variable %s of environment %s/%s", v.Key, user, name)
+	return c.writeTFVar(ctx, "PUT", c.tfVarURL(user, name, v.Key), v)
+}
+
+// DeleteTerraformVariable deletes a variable of the environment. If the
+// variable doesn't exist, an error matching ErrNotFound (see errors.Is) is
+// returned.
+func (c *Client) DeleteTerraformVariable(user, name, key string) error {
+	return c.DeleteTerraformVariableContext(context.Background(), user, name, key)
+}
+
+// DeleteTerraformVariableContext is like DeleteTerraformVariable, but uses
+// the given context for the request.
+func (c *Client) DeleteTerraformVariableContext(ctx context.Context, user, name, key string) error {
+	c.logger().Infof("deleting variable %s of environment %s/%s", key, user, name)
+
+	request, err := c.requestURL(ctx, "DELETE", c.tfVarURL(user, name, key), nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return err
+	}
+	discardResp(response)
+
+	return nil
+}
+
+// VariableAction is what applying a VariableChange does.
+type VariableAction string
+
+// The actions of a VariableChange.
+const (
+	VariableCreate VariableAction = "create"
+	VariableUpdate VariableAction = "update"
+	VariableDelete VariableAction = "delete"
+)
+
+// VariableChange is a single difference between local and remote
+// variables, as returned by DiffVariables.
+type VariableChange struct {
+	Action VariableAction
+	Key    string
+
+	// Old is the remote variable, and is nil for a create. New is the
+	// local variable, with its value as given, and is nil for a delete.
+	Old *TFVar
+	New *TFVar
+}
+
+// String describes the change in the style of a Terraform plan, such as
+// `~ region: "us-east-1" => "us-west-2"`. The values of sensitive variables
+// are masked.
+func (vc *VariableChange) String() string {
+	switch vc.Action {
+	case VariableCreate:
+		return fmt.Sprintf("+ %s = %s", vc.Key, displayTFVar(vc.New))
+	case VariableUpdate:
+		return fmt.Sprintf("~ %s: %s => %s", vc.Key, displayTFVar(vc.Old), displayTFVar(vc.New))
+	case VariableDelete:
+		return fmt.Sprintf("- %s", vc.Key)
+	default:
+		return fmt.Sprintf("? %s", vc.Key)
+	}
+}
+
+// DiffVariables returns the changes that make the remote variables of an
+// environment match the local ones, sorted by key: variables only in local
+// are created, variables only in remote are deleted, and variables whose
+// value or flags differ are updated. The remote values of sensitive
+// variables can't be read, so sensitive variables present on both sides are
+// always updated.
+//
+// Use ApplyVariableChanges to apply the changes.
+func DiffVariables(local, remote []TFVar) []*VariableChange {
+	remoteByKey := make(map[string]*TFVar, len(remote))
+	for i := range remote {
+		remoteByKey[remote[i].Key] = &remote[i]
+	}
+
+	var changes []*VariableChange
+	seen := make(map[string]bool, len(local))
+	for i := range local {
+		l := &local[i]
+		seen[l.Key] = true
+
+		r, ok := remoteByKey[l.Key]
+		switch {
+		case !ok:
+			changes = append(changes, &VariableChange{Action: VariableCreate, Key: l.Key, New: l})
+		case r.Sensitive || *r != *l:
+			changes = append(changes, &VariableChange{Action: VariableUpdate, Key: l.Key, Old: r, New: l})
+		}
+	}
+
+	for i := range remote {
+		r := &remote[i]
+		if !seen[r.Key] {
+			changes = append(changes, &VariableChange{Action: VariableDelete, Key: r.Key, Old: r})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// ApplyVariableChanges applies the given changes, usually returned by
+// DiffVariables, to the variables of the environment. It stops at the first
+// change that fails.
+func (c *Client) ApplyVariableChanges(user, name string, changes []*VariableChange) error {
+	return c.ApplyVariableChangesContext(context.Background(), user, name, changes)
+}
+
+// ApplyVariableChangesContext is like ApplyVariableChanges, but uses the
+// given context for the requests.
+func (c *Client) ApplyVariableChangesContext(ctx context.Context, user, name string,
+	changes []*VariableChange) error {
+	for _, vc := range changes {
+		var err error
+		switch vc.Action {
+		case VariableCreate:
+			_, err = c.CreateTerraformVariableContext(ctx, user, name, *vc.New)
+		case VariableUpdate:
+			_, err = c.UpdateTerraformVariableContext(ctx, user, name, *vc.New)
+		case VariableDelete:
+			err = c.DeleteTerraformVariableContext(ctx, user, name, vc.Key)
+		default:
+			err = fmt.Errorf("client: unknown variable action %q", vc.Action)
+		}
+
+		if err != nil {
+			return fmt.Errorf("client: error applying change to variable %s: %w", vc.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// writeTFVar sends a variable with the given verb and returns the variable
+// saved by the server.
+func (c *Client) writeTFVar(ctx context.Context, verb string, u *url.URL, v TFVar) (*TFVar, error) {
+	// Make sure sensitive values never show up in the logs
+	if v.Sensitive {
+		c.addSecret(v.Value)
+	}
+
+	body, err := json.Marshal(&tfVarWrapper{Variable: &v})
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := c.requestURL(ctx, verb, u, &RequestOptions{
+		Body: bytes.NewReader(body),
+		Headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.decodeTFVar(response)
+}
+
+// decodeTFVar decodes a single wrapped TFVar from the response, masking it
+// if it is sensitive.
+func (c *Client) decodeTFVar(response *http.Response) (*TFVar, error) {
+	var w tfVarWrapper
+	if err := decodeJSON(response, &w); err != nil {
+		return nil, err
+	}
+
+	if w.Variable == nil {
+		return nil, fmt.Errorf("client: missing variable in response")
+	}
+
+	return c.maskTFVar(w.Variable), nil
+}
+
+// maskTFVar replaces the value of a sensitive variable returned by the
+// server with MaskedValue. The server should never return sensitive values,
+// but if it does make sure they don't go any further.
+func (c *Client) maskTFVar(v *TFVar) *TFVar {
+	if v.Sensitive && v.Value != MaskedValue {
+		c.addSecret(v.Value)
+		v.Value = MaskedValue
+	}
+
+	return v
+}
+
+// displayTFVar returns the value of a variable for display, masking it if
+// the variable is sensitive.
+func displayTFVar(v *TFVar) string {
+	switch {
+	case v.Sensitive:
+		return MaskedValue
+	case v.IsHCL:
+		return v.Value
+	default:
+		return strconv.Quote(v.Value)
+	}
+}
+
+// tfVarsPath returns the API path of the variables of an environment.
+func tfVarsPath(user, name string) string {
+	return fmt.Sprintf("/api/v1/terraform/environments/%s/%s/variables", user, name)
+}
+
+// tfVarURL returns the URL of a single variable of an environment. The key is
+// escaped, since variable names aren't restricted to what is safe in a URL,
+// and a key such as "a/b" must stay a single path segment.
+func (c *Client) tfVarURL(user, name, key string) *url.URL {
+	u := c.endpointURL(tfVarsPath(user, name))
+	u.RawPath = u.EscapedPath() + "/" + url.PathEscape(key)
+	u.Path += "/" + key
+	return u
+}
@@ -0,0 +1,246 @@
+package atlas
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTerraformVariables(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars, err := client.TerraformVariables("hashicorp", "existing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []TFVar{
+		{Key: "region", Value: "us-east-1"},
+		{Key: "token", Value: MaskedValue, Sensitive: true},
+		{Key: "zones", Value: `["a", "b"]`, IsHCL: true},
+	}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Fatalf("expected %#v to be %#v", vars, expected)
+	}
+}
+
+func TestTerraformVariable(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := client.TerraformVariable("hashicorp", "existing", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Value != MaskedValue {
+		t.Fatalf("expected %q to be %q", v.Value, MaskedValue)
+	}
+
+	_, err = client.TerraformVariable("hashicorp", "existing", "missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v to be ErrNotFound", err)
+	}
+}
+
+func TestTerraformVariable_crud(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := client.CreateTerraformVariable("hashicorp", "existing", TFVar{
+		Key: "password", Value: "s3cret", Sensitive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Value != MaskedValue {
+		t.Fatalf("expected %q to be %q", v.Value, MaskedValue)
+	}
+
+	_, err = client.CreateTerraformVariable("hashicorp", "existing", TFVar{Key: "region"})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected %v to be ErrConflict", err)
+	}
+
+	v, err = client.UpdateTerraformVariable("hashicorp", "existing", TFVar{
+		Key: "zones", Value: `["c"]`, IsHCL: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Value != `["c"]` || !v.IsHCL {
+		t.Fatalf("bad: %#v", v)
+	}
+
+	if err := client.DeleteTerraformVariable("hashicorp", "existing", "region"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.DeleteTerraformVariable("hashicorp", "existing", "region")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v to be ErrNotFound", err)
+	}
+}
+
+func TestTerraformVariable_escapedKey(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "a/b?c#d"
+	if _, err := client.CreateTerraformVariable("hashicorp", "existing", TFVar{Key: key, Value: "one"}); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := client.UpdateTerraformVariable("hashicorp", "existing", TFVar{Key: key, Value: "two"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Key != key || v.Value != "two" {
+		t.Fatalf("bad: %#v", v)
+	}
+
+	if err := client.DeleteTerraformVariable("hashicorp", "existing", key); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := server.tfVars[key]; ok {
+		t.Fatalf("expected %q to be deleted", key)
+	}
+}
+
+func TestTerraformVariables_logging(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := new(testLogger)
+	client.Logger = l
+
+	if _, err := client.TerraformVariables("hashicorp", "existing"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The test server returns the value of the sensitive variable
+	output := l.String()
+	if !strings.Contains(output, "[DEBUG] response:") {
+		t.Fatalf("expected the response to be logged:\n%s", output)
+	}
+	if strings.Contains(output, "hunter2") {
+		t.Fatalf("sensitive value was logged:\n%s", output)
+	}
+}
+
+func TestDiffVariables(t *testing.T) {
+	local := []TFVar{
+		{Key: "region", Value: "us-west-2"},
+		{Key: "token", Value: "hunter3", Sensitive: true},
+		{Key: "size", Value: "t2.micro"},
+		{Key: "zones", Value: `["a", "b"]`, IsHCL: true},
+	}
+	remote := []TFVar{
+		{Key: "old", Value: "value"},
+		{Key: "region", Value: "us-east-1"},
+		{Key: "token", Value: MaskedValue, Sensitive: true},
+		{Key: "zones", Value: `["a", "b"]`, IsHCL: true},
+	}
+
+	changes := DiffVariables(local, remote)
+
+	var actual []string
+	for _, vc := range changes {
+		actual = append(actual, vc.String())
+	}
+
+	expected := []string{
+		`- old`,
+		`~ region: "us-east-1" => "us-west-2"`,
+		`+ size = "t2.micro"`,
+		`~ token: *** (masked) => *** (masked)`,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %#v to be %#v", actual, expected)
+	}
+
+	for _, s := range actual {
+		if strings.Contains(s, "hunter3") {
+			t.Fatalf("sensitive value in %q", s)
+		}
+	}
+
+	// The local value is kept so the change can be applied
+	if changes[3].New.Value != "hunter3" {
+		t.Fatalf("expected %q to be %q", changes[3].New.Value, "hunter3")
+	}
+
+	if changes := DiffVariables(remote[:2], remote[:2]); len(changes) != 0 {
+		t.Fatalf("expected no changes, got %#v", changes)
+	}
+}
+
+func TestApplyVariableChanges(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := []TFVar{
+		{Key: "region", Value: "us-west-2"},
+		{Key: "size", Value: "t2.micro"},
+		{Key: "token", Value: "hunter3", Sensitive: true},
+	}
+
+	remote, err := client.TerraformVariables("hashicorp", "existing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := DiffVariables(local, remote)
+	if err := client.ApplyVariableChanges("hashicorp", "existing", changes); err != nil {
+		t.Fatal(err)
+	}
+
+	remote, err = client.TerraformVariables("hashicorp", "existing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []TFVar{
+		{Key: "region", Value: "us-west-2"},
+		{Key: "size", Value: "t2.micro"},
+		{Key: "token", Value: MaskedValue, Sensitive: true},
+	}
+	if !reflect.DeepEqual(remote, expected) {
+		t.Fatalf("expected %#v to be %#v", remote, expected)
+	}
+
+	if server.tfVars["token"].Value != "hunter3" {
+		t.Fatalf("expected %q to be %q", server.tfVars["token"].Value, "hunter3")
+	}
+}
@@ -0,0 +1,503 @@
+package atlas
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultUploadConcurrency is the number of chunks uploaded at once when
+// UploadOptions.Concurrency isn't set.
+const DefaultUploadConcurrency = 4
+
+// UploadOptions control how files are uploaded by UploadArtifact,
+// UploadApp, UploadBuildConfigVersion, CreateTerraformConfigVersion and
+// the other methods that upload files.
+//
+// They can be set for every upload on Client.UploadOptions, or for a single
+// upload on UploadArtifactOpts.Upload or with the Context variants of the
+// other methods, such as UploadAppContext.
+type UploadOptions struct {
+	// Progress, if set, is called periodically as the file is uploaded,
+	// and once it is complete.
+	Progress ProgressFunc
+
+	// BandwidthLimit is the maximum upload speed, in bytes per second.
+	// Zero means no limit.
+	BandwidthLimit int64
+
+	// ChunkSize, if set, makes files larger than ChunkSize bytes upload in
+	// chunks of that size rather than in a single request, so that a
+	// failure only costs the chunks that didn't make it. Chunks that fail
+	// are retried according to the client's RetryPolicy, and if the upload
+	// still fails an *UploadError is returned that can be given to
+	// ResumeUpload to upload the remaining chunks later.
+	//
+	// Chunked uploads need a file that implements io.ReaderAt and
+	// io.Seeker, such as an *os.File, a *bytes.Reader or an
+	// *archive.Archive. Other files are uploaded in a single request.
+	//
+	// Each chunk is sent to the upload URL with a PUT request that has a
+	// "Content-Range: bytes <first>-<last>/<size>" header. Once every chunk
+	// has been accepted, a PUT with an empty body and a
+	// "Content-Range: bytes */<size>" header asks the storage to complete
+	// the upload.
+	ChunkSize int64
+
+	// Concurrency is the number of chunks uploaded at once. If it is zero,
+	// DefaultUploadConcurrency is used.
+	Concurrency int
+
+	// ContentMD5 sends the MD5 digest of every upload request's body in a
+	// Content-MD5 header, so that the storage can reject corrupted data,
+	// and checks it against an MD5 ETag in the response. The digest is
+	// computed by reading the data before it is sent, so it is only sent for
+	// files that implement io.Seeker; other files are uploaded without it.
+	ContentMD5 bool
+}
+
+// StorageChecksumHeader is the response header in which the storage may
+// return the hex-encoded SHA-256 checksum of the data it received. If it
+// does, an upload fails with a *ChecksumError when the checksum doesn't
+// match the data that was sent.
+const StorageChecksumHeader = "X-Checksum-Sha256"
+
+// uploadOptions returns the options for an upload: the given ones if they
+// are set, or else the client's.
+func (c *Client) uploadOptions(opts *UploadOptions) *UploadOptions {
+	if opts != nil {
+		return opts
+	}
+
+	if c.UploadOptions != nil {
+		return c.UploadOptions
+	}
+
+	return new(UploadOptions)
+}
+
+// UploadCheckpoint records how far a chunked upload got. It can be saved
+// (it is JSON-encodable) and given to ResumeUpload to finish the upload.
+type UploadCheckpoint struct {
+	// UploadPath is the URL the file is uploaded to.
+	UploadPath string `json:"upload_path"`
+
+	// Size is the size of the file and ChunkSize the size of its chunks.
+	Size      int64 `json:"size"`
+	ChunkSize int64 `json:"chunk_size"`
+
+	// Completed lists the chunks, by index, the storage has accepted.
+	Completed []int `json:"completed"`
+
+	// SHA256 is the hex-encoded SHA-256 checksum of the file, if known.
+	// It is checked against the checksum the storage returns once the
+	// upload is complete.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// UploadError is returned when a chunked upload fails. Checkpoint records
+// the chunks that were uploaded, so the upload can be resumed.
+type UploadError struct {
+	Checkpoint *UploadCheckpoint
+	Err        error
+}
+
+func (e *UploadError) Error() string {
+	return fmt.Sprintf("client: upload failed with %d of %d chunks complete: %s",
+		len(e.Checkpoint.Completed), e.Checkpoint.chunks(), e.Err)
+}
+
+// Unwrap returns the error that made the upload fail.
+func (e *UploadError) Unwrap() error {
+	return e.Err
+}
+
+// chunks returns the number of chunks in the upload.
+func (cp *UploadCheckpoint) chunks() int {
+	if cp.ChunkSize <= 0 {
+		return 0
+	}
+
+	return int((cp.Size + cp.ChunkSize - 1) / cp.ChunkSize)
+}
+
+// ResumeUpload continues a chunked upload that failed with an *UploadError,
+// uploading the chunks that are missing from the checkpoint and completing
+// the upload. The file must be the same one that was originally uploaded,
+// and r must read it from its start. The progress, bandwidth limit and
+// concurrency are taken from the client's UploadOptions.
+func (c *Client) ResumeUpload(cp *UploadCheckpoint, r io.ReaderAt) error {
+	return c.ResumeUploadContext(context.Background(), cp, r, nil)
+}
+
+// ResumeUploadContext is like ResumeUpload, but uses the given context for
+// the requests, and the given upload options, if not nil, instead of the
+// client's UploadOptions. Their ChunkSize is ignored; the checkpoint's is
+// used.
+func (c *Client) ResumeUploadContext(ctx context.Context, cp *UploadCheckpoint, r io.ReaderAt,
+	opts *UploadOptions) error {
+	if cp.ChunkSize <= 0 {
+		return fmt.Errorf("client: invalid chunk size %d", cp.ChunkSize)
+	}
+
+	c.logger().Infof("resuming upload: %s (%d of %d chunks complete)",
+		cp.UploadPath, len(cp.Completed), cp.chunks())
+
+	_, err := c.uploadChunks(ctx, cp, r, c.uploadOptions(opts))
+	return err
+}
+
+// chunkSource is a file that can be uploaded in chunks.
+type chunkSource interface {
+	io.ReaderAt
+	io.Seeker
+}
+
+// putChunked uploads the file from its current position in chunks, and
+// returns its checksum like completeChunks.
+func (c *Client) putChunked(ctx context.Context, rawURL string, source chunkSource,
+	size int64, sum string, opts *UploadOptions) (string, error) {
+	offset, err := source.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+
+	cp := &UploadCheckpoint{
+		UploadPath: rawURL,
+		Size:       size,
+		ChunkSize:  opts.ChunkSize,
+		SHA256:     sum,
+	}
+
+	return c.uploadChunks(ctx, cp, io.NewSectionReader(source, offset, size), opts)
+}
+
+// uploadChunks uploads the chunks missing from the checkpoint concurrently,
+// then completes the upload, returning the checksum of the file like
+// completeChunks.
+func (c *Client) uploadChunks(ctx context.Context, cp *UploadCheckpoint, r io.ReaderAt,
+	opts *UploadOptions) (string, error) {
+	total := cp.chunks()
+	done := make(map[int]bool, total)
+	var uploaded int64
+	for _, i := range cp.Completed {
+		if i >= 0 && i < total && !done[i] {
+			done[i] = true
+			uploaded += chunkLength(cp, i)
+		}
+	}
+
+	var pending []int
+	for i := 0; i < total; i++ {
+		if !done[i] {
+			pending = append(pending, i)
+		}
+	}
+
+	t := newTransfer(opts, cp.Size)
+	t.progress.reset(uploaded, -1)
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultUploadConcurrency
+	}
+
+	// Stop the other chunks as soon as one fails for good
+	chunkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		lock     sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	chunks := make(chan int)
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range chunks {
+				err := c.putChunk(chunkCtx, cp, r, i, t)
+
+				lock.Lock()
+				if err == nil {
+					done[i] = true
+				} else if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+
+send:
+	for _, i := range pending {
+		select {
+		case chunks <- i:
+		case <-chunkCtx.Done():
+			break send
+		}
+	}
+	close(chunks)
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	var sum string
+	if firstErr == nil {
+		sum, firstErr = c.completeChunks(ctx, cp)
+	}
+	if firstErr != nil {
+		checkpoint := *cp
+		checkpoint.Completed = make([]int, 0, len(done))
+		for i := range done {
+			checkpoint.Completed = append(checkpoint.Completed, i)
+		}
+		sort.Ints(checkpoint.Completed)
+
+		return "", &UploadError{Checkpoint: &checkpoint, Err: firstErr}
+	}
+
+	return sum, nil
+}
+
+// putChunk uploads the chunk with the given index.
+func (c *Client) putChunk(ctx context.Context, cp *UploadCheckpoint, r io.ReaderAt,
+	i int, t *transfer) error {
+	start := int64(i) * cp.ChunkSize
+	length := chunkLength(cp, i)
+
+	c.logger().Debugf("uploading chunk %d (bytes %d-%d) of %s",
+		i, start, start+length-1, cp.UploadPath)
+
+	_, err := c.put(ctx, cp.UploadPath, io.NewSectionReader(r, start, length), length,
+		map[string]string{
+			"Content-Range": fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, cp.Size),
+		}, t)
+	return err
+}
+
+// completeChunks asks the storage to assemble the uploaded chunks. The
+// storage's checksum of the whole file is compared to the checkpoint's. It
+// returns the checkpoint's checksum, or the storage's if the checkpoint has
+// none.
+func (c *Client) completeChunks(ctx context.Context, cp *UploadCheckpoint) (string, error) {
+	c.logger().Debugf("completing upload of %d chunks: %s", cp.chunks(), cp.UploadPath)
+
+	url, err := url.Parse(cp.UploadPath)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := c.rawRequest(ctx, "PUT", url, &RequestOptions{
+		Headers: map[string]string{
+			"Content-Range": fmt.Sprintf("bytes */%d", cp.Size),
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	response, err := c.do(request)
+	if err != nil {
+		return "", err
+	}
+	discardResp(response)
+
+	if err := verifyStorage(response.Header, cp.SHA256, ""); err != nil {
+		return "", err
+	}
+
+	if cp.SHA256 != "" {
+		return cp.SHA256, nil
+	}
+
+	return strings.ToLower(response.Header.Get(StorageChecksumHeader)), nil
+}
+
+// chunkLength returns the length of the chunk with the given index; the
+// last chunk may be shorter than the others.
+func chunkLength(cp *UploadCheckpoint, i int) int64 {
+	start := int64(i) * cp.ChunkSize
+	if rest := cp.Size - start; rest < cp.ChunkSize {
+		return rest
+	}
+
+	return cp.ChunkSize
+}
+
+// transfer is the state shared by the requests that upload a file: its
+// progress and bandwidth limit.
+type transfer struct {
+	progress   *progressTracker
+	contentMD5 bool
+
+	// limit is the bandwidth limit in bytes per second, and sent how much
+	// was sent since start.
+	lock  sync.Mutex
+	limit int64
+	start time.Time
+	sent  int64
+}
+
+func newTransfer(opts *UploadOptions, size int64) *transfer {
+	return &transfer{
+		progress:   newProgressTracker(opts.Progress, 0, size),
+		contentMD5: opts.ContentMD5,
+		limit:      opts.BandwidthLimit,
+		start:      time.Now(),
+	}
+}
+
+// chunk returns how much may be read at once, so that limited uploads are
+// smooth rather than bursty.
+func (t *transfer) chunk(n int) int {
+	if t.limit <= 0 {
+		return n
+	}
+
+	chunk := t.limit / 10
+	if chunk < 1 {
+		chunk = 1
+	}
+	if int64(n) > chunk {
+		return int(chunk)
+	}
+
+	return n
+}
+
+// wait records that n bytes were sent and blocks for as long as needed to
+// keep to the bandwidth limit.
+func (t *transfer) wait(ctx context.Context, n int) error {
+	if t.limit <= 0 {
+		return nil
+	}
+
+	t.lock.Lock()
+	t.sent += int64(n)
+	expected := time.Duration(float64(t.sent) / float64(t.limit) * float64(time.Second))
+	wait := expected - time.Since(t.start)
+	t.lock.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// uploadReader reads the body of an upload request, reporting progress,
+// keeping to the bandwidth limit of its transfer and hashing the data.
+type uploadReader struct {
+	ctx  context.Context
+	t    *transfer
+	src  io.Reader
+	size int64
+
+	// r reads size bytes of src, writing them to sha256.
+	r      io.Reader
+	sha256 hash.Hash
+
+	// read is how much of the body was read, so it can be taken back out
+	// of the progress if the request is retried.
+	read int64
+}
+
+func newUploadReader(ctx context.Context, src io.Reader, size int64, t *transfer) *uploadReader {
+	u := &uploadReader{ctx: ctx, t: t, src: src, size: size, sha256: sha256.New()}
+	u.rewind()
+
+	return u
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p[:u.t.chunk(len(p))])
+	if n > 0 {
+		u.read += int64(n)
+		u.t.progress.add(int64(n))
+
+		if werr := u.t.wait(u.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
+
+// reset rewinds the progress and the hashes to before this body was read,
+// when the request is retried. The source must be rewound by the caller.
+func (u *uploadReader) reset() {
+	u.t.progress.add(-u.read)
+	u.read = 0
+	u.rewind()
+}
+
+// rewind starts reading the source and hashing it over.
+func (u *uploadReader) rewind() {
+	u.sha256.Reset()
+	u.r = io.TeeReader(io.LimitReader(u.src, u.size), u.sha256)
+}
+
+// hashSection returns the digest of the size bytes of r starting at offset,
+// using h, then seeks back to offset.
+func hashSection(ctx context.Context, h hash.Hash, r io.Reader, seeker io.Seeker,
+	offset, size int64) ([]byte, error) {
+	if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(h, &contextReader{ctx: ctx, r: io.LimitReader(r, size)}); err != nil {
+		return nil, err
+	}
+
+	if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+// verifyStorage compares the checksums the storage returned in the given
+// response header to the hex-encoded checksums of the data that was sent.
+// Empty checksums aren't compared.
+func verifyStorage(header http.Header, sha256sum, md5sum string) error {
+	if actual := strings.ToLower(header.Get(StorageChecksumHeader)); actual != "" && sha256sum != "" {
+		if actual != sha256sum {
+			return &ChecksumError{Type: "sha256", Expected: sha256sum, Actual: actual}
+		}
+	}
+
+	// Only an ETag that looks like an MD5 digest is one; multipart uploads
+	// and other storage use ETags of a different form.
+	etag := strings.ToLower(strings.Trim(header.Get("ETag"), `"`))
+	if md5sum != "" && len(etag) == 32 && isHex(etag) && etag != md5sum {
+		return &ChecksumError{Type: "md5", Expected: md5sum, Actual: etag}
+	}
+
+	return nil
+}
+
+// isHex reports whether s only contains hexadecimal digits.
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,351 @@
+package atlas
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testProgress records the progress reports it receives.
+type testProgress struct {
+	lock    sync.Mutex
+	reports []Progress
+}
+
+func (p *testProgress) report(progress Progress) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.reports = append(p.reports, progress)
+}
+
+func (p *testProgress) last() Progress {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.reports) == 0 {
+		return Progress{}
+	}
+	return p.reports[len(p.reports)-1]
+}
+
+func TestPutFile_progress(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress := new(testProgress)
+	client.UploadOptions = &UploadOptions{Progress: progress.report}
+
+	data := bytes.NewReader(bytes.Repeat([]byte("a"), 100000))
+	err = client.putFile(context.Background(),
+		server.URL.String()+"/_binstore/", data, data.Size(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := progress.last()
+	if last.Bytes != 100000 || last.Total != 100000 {
+		t.Fatalf("bad: %#v", last)
+	}
+	if last.ETA != 0 {
+		t.Fatalf("expected %s to be 0", last.ETA)
+	}
+}
+
+func TestPutFile_progressRetry(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client := testRetryClient(t, server)
+
+	progress := new(testProgress)
+	opts := &UploadOptions{Progress: progress.report}
+
+	data := bytes.NewReader([]byte("hello world"))
+	err := client.putFile(context.Background(),
+		server.URL.String()+"/_binstore-flaky/", data, data.Size(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The retried upload starts over rather than counting the bytes twice
+	last := progress.last()
+	if last.Bytes != 11 || last.Total != 11 {
+		t.Fatalf("bad: %#v", last)
+	}
+}
+
+func TestPutFile_bandwidthLimit(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.UploadOptions = &UploadOptions{BandwidthLimit: 1 << 30}
+
+	// The limit passed with the upload overrides the client's
+	opts := &UploadOptions{BandwidthLimit: 20000}
+
+	data := bytes.NewReader(make([]byte, 10000))
+	start := time.Now()
+	err = client.putFile(context.Background(),
+		server.URL.String()+"/_binstore/", data, data.Size(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("expected upload to take at least 400ms, took %s", elapsed)
+	}
+}
+
+func TestPutFile_bandwidthLimitCanceled(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.UploadOptions = &UploadOptions{BandwidthLimit: 10}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	data := bytes.NewReader(make([]byte, 10000))
+	err = client.putFile(ctx, server.URL.String()+"/_binstore/", data, data.Size(), nil)
+	if err == nil {
+		t.Fatal("expected error, but nothing was returned")
+	}
+}
+
+func TestPutFile_chunked(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress := new(testProgress)
+	client.UploadOptions = &UploadOptions{
+		Progress:    progress.report,
+		ChunkSize:   4,
+		Concurrency: 3,
+	}
+
+	data := bytes.NewReader([]byte("hello, chunked world"))
+	err = client.putFile(context.Background(),
+		server.URL.String()+"/_binstore-chunked/ok", data, data.Size(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploads := server.uploadedBodies()
+	if len(uploads) != 1 || uploads[0] != "hello, chunked world" {
+		t.Fatalf("bad: %#v", uploads)
+	}
+
+	last := progress.last()
+	if last.Bytes != 20 || last.Total != 20 {
+		t.Fatalf("bad: %#v", last)
+	}
+}
+
+func TestPutFile_chunkedRetry(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client := testRetryClient(t, server)
+	client.UploadOptions = &UploadOptions{ChunkSize: 4}
+
+	data := bytes.NewReader([]byte("hello, chunked world"))
+	err := client.putFile(context.Background(),
+		server.URL.String()+"/_binstore-chunked/fail-8", data, data.Size(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploads := server.uploadedBodies()
+	if len(uploads) != 1 || uploads[0] != "hello, chunked world" {
+		t.Fatalf("bad: %#v", uploads)
+	}
+
+	// Only the failed chunk is sent again
+	if n := server.attemptCount("/_binstore-chunked/fail-8@8"); n != 2 {
+		t.Fatalf("expected 2 attempts, got %d", n)
+	}
+	if n := server.attemptCount("/_binstore-chunked/fail-8@0"); n != 1 {
+		t.Fatalf("expected 1 attempt, got %d", n)
+	}
+}
+
+func TestPutFile_chunkedResume(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.RetryPolicy = nil
+	client.UploadOptions = &UploadOptions{ChunkSize: 4, Concurrency: 1}
+
+	content := []byte("hello, chunked world")
+	data := bytes.NewReader(content)
+	err = client.putFile(context.Background(),
+		server.URL.String()+"/_binstore-chunked/fail-8", data, data.Size(), nil)
+
+	var uploadErr *UploadError
+	if !errors.As(err, &uploadErr) {
+		t.Fatalf("expected *UploadError, got %#v", err)
+	}
+	if !errors.Is(err, ErrServer) {
+		t.Fatalf("expected %s to be ErrServer", err)
+	}
+
+	cp := uploadErr.Checkpoint
+	if !reflect.DeepEqual(cp.Completed, []int{0, 1}) {
+		t.Fatalf("bad: %#v", cp.Completed)
+	}
+
+	// The options passed with the resumed upload are used
+	progress := new(testProgress)
+	err = client.ResumeUploadContext(context.Background(), cp, bytes.NewReader(content),
+		&UploadOptions{Progress: progress.report, Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := progress.last(); last.Bytes != 20 || last.Total != 20 {
+		t.Fatalf("bad: %#v", last)
+	}
+
+	uploads := server.uploadedBodies()
+	if len(uploads) != 1 || uploads[0] != string(content) {
+		t.Fatalf("bad: %#v", uploads)
+	}
+	if n := server.attemptCount("/_binstore-chunked/fail-8@0"); n != 1 {
+		t.Fatalf("expected 1 attempt, got %d", n)
+	}
+}
+
+func TestPutFile_chunkedNotReaderAt(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.UploadOptions = &UploadOptions{ChunkSize: 4}
+
+	// Sources that can't be read at an offset are uploaded whole
+	data := io.MultiReader(bytes.NewReader([]byte("hello world")))
+	err = client.putFile(context.Background(),
+		server.URL.String()+"/_binstore-flaky/", data, 11, nil)
+	if err == nil {
+		t.Fatal("expected error, but nothing was returned")
+	}
+
+	uploads := server.uploadedBodies()
+	if len(uploads) != 1 || uploads[0] != "hello world" {
+		t.Fatalf("bad: %#v", uploads)
+	}
+}
+
+func TestPutFile_checksumChanged(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The data sent isn't what was hashed beforehand
+	data := bytes.NewReader([]byte("hello"))
+	_, err = client.putFileChecksum(context.Background(), server.URL.String()+"/_binstore/",
+		data, data.Size(), "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9825", nil)
+
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("expected *ChecksumError, got %#v", err)
+	}
+}
+
+func TestPutFile_contentMD5(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.UploadOptions = &UploadOptions{ContentMD5: true}
+
+	data := bytes.NewReader([]byte("hello"))
+	err = client.putFile(context.Background(),
+		server.URL.String()+"/_binstore/md5", data, data.Size(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPutFile_contentMD5NotSeekable(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.UploadOptions = &UploadOptions{ContentMD5: true}
+
+	// The digest can't be sent without reading the file twice
+	data := io.MultiReader(bytes.NewReader([]byte("hello")))
+	err = client.putFile(context.Background(),
+		server.URL.String()+"/_binstore/", data, 5, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data = io.MultiReader(bytes.NewReader([]byte("hello")))
+	err = client.putFile(context.Background(),
+		server.URL.String()+"/_binstore/md5", data, 5, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 400 {
+		t.Fatalf("expected the storage to require Content-MD5, got %v", err)
+	}
+}
+
+func TestPutFile_chunkedChecksum(t *testing.T) {
+	server := newTestAtlasServer(t)
+	defer server.Stop()
+
+	client, err := NewClient(server.URL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.UploadOptions = &UploadOptions{ChunkSize: 4}
+
+	data := bytes.NewReader([]byte("hello, chunked world"))
+	_, err = client.putFileChecksum(context.Background(),
+		server.URL.String()+"/_binstore-chunked/ok", data, data.Size(),
+		"0000000000000000000000000000000000000000000000000000000000000000", nil)
+
+	var checksumErr *ChecksumError
+	if !errors.As(err, &checksumErr) {
+		t.Fatalf("expected *ChecksumError, got %#v", err)
+	}
+}